@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/virtual-kubelet/virtual-kubelet/providers/vic/proxy"
 	"github.com/vmware/vic/pkg/trace"
 )
 
@@ -29,11 +31,20 @@ type VicConfig struct {
 	PersonaAddr   string `yaml:"persona-server"`
 	PortlayerAddr string `yaml:"portlayer-server"`
 
+	// ShortNameMode controls how bare image references (e.g. "nginx") that
+	// don't name an explicit registry are resolved: "enforcing",
+	// "permissive", or "docker-hub-only".
+	ShortNameMode proxy.ShortNameMode `yaml:"short-name-mode"`
+	// ShortNameAliases maps a short name to the fully-qualified reference it
+	// should resolve to, checked before ShortNameMode is applied.
+	ShortNameAliases map[string]string `yaml:"short-name-aliases"`
 }
 
 const (
-	personaAddrEnv   = "PERSONA_ADDR"
-	portlayerAddrEnv = "PORTLAYER_ADDR"
+	personaAddrEnv      = "PERSONA_ADDR"
+	portlayerAddrEnv    = "PORTLAYER_ADDR"
+	shortNameModeEnv    = "SHORT_NAME_MODE"
+	shortNameAliasesEnv = "SHORT_NAME_ALIASES"
 )
 
 func NewVicConfig(op trace.Operation, configFile string) VicConfig {
@@ -73,4 +84,25 @@ func (v *VicConfig) loadConfigFile(configFile string) error {
 func (v *VicConfig) loadConfigFromEnv() {
 	v.PersonaAddr = os.Getenv(personaAddrEnv)
 	v.PortlayerAddr = os.Getenv(portlayerAddrEnv)
+	v.ShortNameMode = proxy.ShortNameMode(os.Getenv(shortNameModeEnv))
+	v.ShortNameAliases = parseShortNameAliases(os.Getenv(shortNameAliasesEnv))
+}
+
+// parseShortNameAliases parses SHORT_NAME_ALIASES as a comma-separated list
+// of "shortname=fully/qualified/ref" pairs.
+func parseShortNameAliases(raw string) map[string]string {
+	if raw == "" {
+		return nil
+	}
+
+	aliases := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		aliases[kv[0]] = kv[1]
+	}
+
+	return aliases
 }
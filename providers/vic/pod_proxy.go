@@ -3,28 +3,128 @@ package vic
 import (
 	"context"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/apex/log"
+	"github.com/docker/go-connections/nat"
 	units "github.com/docker/go-units"
 	engerr "github.com/vmware/vic/lib/apiservers/engine/errors"
 	"github.com/vmware/vic/lib/apiservers/portlayer/client"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/containers"
 	"github.com/vmware/vic/pkg/trace"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/moby/moby/api/types"
+	"github.com/virtual-kubelet/virtual-kubelet/providers/vic/proxy"
 	"k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 )
 
 type VicPodProxy interface {
 	CreatePod(ctx context.Context, pod *v1.Pod) error
+	UpdatePod(ctx context.Context, pod *v1.Pod) error
+	DeletePod(ctx context.Context, pod *v1.Pod) error
+	GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error)
+	GetPods(ctx context.Context) ([]*v1.Pod, error)
+	GetPodStatus(ctx context.Context, namespace, name string) (*v1.PodStatus, error)
+	GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts ContainerLogOpts) (io.ReadCloser, error)
+	GetPodStats(ctx context.Context, namespace, name string) (*PodStats, error)
+	RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error
+}
+
+// ContainerLogOpts mirrors the options the kubelet's logs endpoint can
+// request; it's threaded through to GetContainerLogs.
+type ContainerLogOpts struct {
+	Tail         int
+	SinceSeconds int
+	Follow       bool
+	Timestamps   bool
 }
 
 type PodProxy struct {
-	client     *client.PortLayer
-	imageStore VicImageStore
-	//containerStore
+	client         *client.PortLayer
+	imageStore     proxy.ImageStore
+	isolationProxy proxy.IsolationProxy
+	containerStore *containerStore
+	healthMonitor  *proxy.HealthMonitor
+}
+
+// sandbox holds the state virtual-kubelet needs to operate on a pod as a
+// single unit: the infra/sandbox container that owns the pod's shared
+// namespaces, and the app containers joined to it.
+type sandbox struct {
+	InfraID      string
+	ContainerIDs map[string]string // container name -> container ID
+	ImageIDs     map[string]string // container name -> resolved image ID
+	Pod          *v1.Pod
+
+	// probedContainers marks which ContainerIDs entries have a readiness
+	// probe running under PodProxy.healthMonitor; containers without one are
+	// always ready. Keyed by container name, same as ContainerIDs.
+	probedContainers map[string]bool
+}
+
+// containerStore tracks the pod UID -> sandbox mapping so DeletePod/GetPod/
+// GetPodStatus can operate at pod granularity instead of per-container.
+type containerStore struct {
+	mu        sync.RWMutex
+	sandboxes map[k8stypes.UID]*sandbox
+}
+
+func newContainerStore() *containerStore {
+	return &containerStore{
+		sandboxes: make(map[k8stypes.UID]*sandbox),
+	}
+}
+
+func (c *containerStore) put(podUID k8stypes.UID, s *sandbox) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sandboxes[podUID] = s
+}
+
+func (c *containerStore) get(podUID k8stypes.UID) (*sandbox, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok := c.sandboxes[podUID]
+	return s, ok
+}
+
+func (c *containerStore) getByName(namespace, name string) (*sandbox, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, s := range c.sandboxes {
+		if s.Pod.Namespace == namespace && s.Pod.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (c *containerStore) list() []*sandbox {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sandboxes := make([]*sandbox, 0, len(c.sandboxes))
+	for _, s := range c.sandboxes {
+		sandboxes = append(sandboxes, s)
+	}
+	return sandboxes
+}
+
+func (c *containerStore) delete(podUID k8stypes.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sandboxes, podUID)
 }
 
 const (
@@ -40,59 +140,595 @@ const (
 	MinCPUs = 1
 	// DefaultCPUs - the default number of container VM CPUs
 	DefaultCPUs = 2
+
+	// DummyInfraImage is the placeholder image used for a pod's infra/sandbox
+	// container until we have a minimal pause-equivalent image of our own.
+	DummyInfraImage = "busybox"
+
+	// containerStateStopped is the state string StateChange expects to stop a
+	// running container ahead of removing it.
+	containerStateStopped = "STOPPED"
 )
 
-func NewPodProxy(plClient *client.PortLayer, imageStore VicImageStore) VicPodProxy {
+func NewPodProxy(plClient *client.PortLayer, imageStore proxy.ImageStore, isolationProxy proxy.IsolationProxy) VicPodProxy {
 	if plClient == nil {
 		return nil
 	}
 
 	return &PodProxy{
-		client:     plClient,
-		imageStore: imageStore,
+		client:         plClient,
+		imageStore:     imageStore,
+		isolationProxy: isolationProxy,
+		containerStore: newContainerStore(),
+		healthMonitor:  proxy.NewHealthMonitor(isolationProxy),
 	}
 }
 
+// CreatePod creates the pod's infra/sandbox container first so that it can
+// own the pod's shared network/IPC/PID namespaces, then creates each app
+// container joined to that sandbox.  The pod UID -> sandbox + container ID
+// mapping is recorded in the containerStore so later operations (delete,
+// status) can be resolved at pod granularity.
 func (p *PodProxy) CreatePod(ctx context.Context, pod *v1.Pod) error {
-	op := trace.FromContext(ctx, "createContainer")
+	op := trace.FromContext(ctx, "CreatePod")
+
+	infraConfig := podSpecToInfraCreateSpec(pod)
+	infraID, _, err := p.createContainer(ctx, pod.Namespace, pod.Spec.ImagePullSecrets, proxy.PullIfNotPresent, infraConfig)
+	if err != nil {
+		op.Errorf("Failed to create infra container for pod %s: %s", pod.Name, err.Error())
+		return err
+	}
 
-	// Create each container.  Only for prototype only.
+	containerIDs := make(map[string]string, len(pod.Spec.Containers))
+	imageIDs := make(map[string]string, len(pod.Spec.Containers))
+	probedContainers := make(map[string]bool)
+
+	if err := p.provisionPodVolumes(ctx, pod); err != nil {
+		op.Errorf("Failed to provision volumes for pod %s: %s", pod.Name, err.Error())
+		p.teardownPartialPod(ctx, infraID, containerIDs, probedContainers)
+		return fmt.Errorf("CreatePod: %s", err.Error())
+	}
+
+	sb := &sandbox{
+		InfraID: infraID,
+		Pod:     pod,
+	}
+
+	// Create each app container.  Only for prototype only.
 	for _, c := range pod.Spec.Containers {
-		// Transform kube container config to docker create config
-		createConfig := KubeSpecToDockerCreateSpec(c)
+		if _, err := kubeVolumesToDockerMounts(pod.UID, pod.Spec.Volumes, c.VolumeMounts); err != nil {
+			op.Errorf("Failed to translate volumes for container %s of pod %s: %s", c.Name, pod.Name, err.Error())
+			p.teardownPartialPod(ctx, infraID, containerIDs, probedContainers)
+			return fmt.Errorf("CreatePod: container %s: %s", c.Name, err.Error())
+		}
+
+		// Transform kube container config to docker create config, joined to
+		// the pod's infra container namespaces.
+		createConfig := containerSpecToCreateSpec(pod.UID, infraID, pod.Spec.Volumes, c)
 
-		err := p.createContainer(ctx, createConfig)
+		id, imageID, err := p.createContainer(ctx, pod.Namespace, pod.Spec.ImagePullSecrets, imagePullPolicy(c), createConfig)
 		if err != nil {
-			op.Errorf("Failed to create container %s for pod %s", createConfig.Name, pod.Name)
+			op.Errorf("Failed to create container %s for pod %s: %s", createConfig.Name, pod.Name, err.Error())
+			p.teardownPartialPod(ctx, infraID, containerIDs, probedContainers)
+			return fmt.Errorf("CreatePod: failed to create container %s: %s", c.Name, err.Error())
+		}
+		containerIDs[c.Name] = id
+		imageIDs[c.Name] = imageID
+
+		if c.ReadinessProbe == nil {
+			// No readiness gate configured; Kubernetes treats the container
+			// as ready as soon as it's running.
+			continue
+		}
+
+		spec, err := kubeProbeToProbeSpec(id, c.ReadinessProbe)
+		if err != nil {
+			op.Errorf("Failed to translate readiness probe for container %s: %s", c.Name, err.Error())
+			continue
+		}
+
+		// Monitoring is keyed by container ID and torn down explicitly by
+		// DeletePod via healthMonitor.Stop, so it isn't tied to CreatePod's
+		// own ctx.
+		p.healthMonitor.Start(context.Background(), id, spec)
+		probedContainers[c.Name] = true
+	}
+
+	sb.ContainerIDs = containerIDs
+	sb.ImageIDs = imageIDs
+	sb.probedContainers = probedContainers
+	p.containerStore.put(pod.UID, sb)
+
+	return nil
+}
+
+// kubeProbeToProbeSpec translates a Kubernetes probe into the
+// proxy.ProbeSpec HealthCheckRun/HealthMonitor evaluate. containerID is the
+// portlayer ID of the container the probe is for.
+func kubeProbeToProbeSpec(containerID string, probe *v1.Probe) (proxy.ProbeSpec, error) {
+	spec := proxy.ProbeSpec{
+		InitialDelay:     time.Duration(probe.InitialDelaySeconds) * time.Second,
+		Period:           time.Duration(probe.PeriodSeconds) * time.Second,
+		Timeout:          time.Duration(probe.TimeoutSeconds) * time.Second,
+		SuccessThreshold: int(probe.SuccessThreshold),
+		FailureThreshold: int(probe.FailureThreshold),
+	}
+
+	switch {
+	case probe.Exec != nil:
+		spec.Type = proxy.ProbeExec
+		spec.Command = probe.Exec.Command
+	case probe.HTTPGet != nil:
+		spec.Type = proxy.ProbeHTTP
+		spec.HTTPPath = probe.HTTPGet.Path
+		spec.Host = probe.HTTPGet.Host
+		spec.Port = probe.HTTPGet.Port.IntValue()
+	case probe.TCPSocket != nil:
+		spec.Type = proxy.ProbeTCP
+		spec.Host = probe.TCPSocket.Host
+		spec.Port = probe.TCPSocket.Port.IntValue()
+	default:
+		return proxy.ProbeSpec{}, fmt.Errorf("probe has none of Exec/HTTPGet/TCPSocket set")
+	}
+
+	if spec.Type != proxy.ProbeExec && spec.Host == "" {
+		// HTTPGet.Host/TCPSocket.Host default to "" meaning "the pod's own
+		// address" - there's no shared loopback to fall back to here since
+		// each container is its own scope-attached VM, so the equivalent is
+		// the container's own ID, resolved by httpProbe/tcpProbe through the
+		// VCH's embedded per-scope DNS.
+		spec.Host = containerID
+	}
+
+	return spec, nil
+}
+
+// UpdatePod applies an updated pod spec.  VIC containers can't be
+// reconfigured in place, so, like most simple providers, we implement
+// update as delete-then-recreate.
+func (p *PodProxy) UpdatePod(ctx context.Context, pod *v1.Pod) error {
+	if err := p.DeletePod(ctx, pod); err != nil {
+		return err
+	}
+
+	return p.CreatePod(ctx, pod)
+}
+
+// DeletePod stops and removes the pod's app containers followed by its
+// infra/sandbox container, then drops the pod from the containerStore. The
+// pod is only dropped from the containerStore once every container has been
+// torn down cleanly; if any teardown fails, the sandbox is left in place (so
+// GetPod/GetPodStatus can still resolve it and a retry can find the
+// still-live containers) and the failures are returned as a single error.
+func (p *PodProxy) DeletePod(ctx context.Context, pod *v1.Pod) error {
+	op := trace.FromContext(ctx, "DeletePod")
+
+	s, ok := p.containerStore.get(pod.UID)
+	if !ok {
+		return engerr.NotFoundError(pod.Name)
+	}
+
+	var failures []string
+
+	for name, id := range s.ContainerIDs {
+		if s.probedContainers[name] {
+			p.healthMonitor.Stop(id)
+		}
+		if err := p.stopAndRemoveContainer(ctx, id); err != nil {
+			op.Errorf("Failed to remove container %s for pod %s: %s", name, pod.Name, err.Error())
+			failures = append(failures, fmt.Sprintf("container %s: %s", name, err.Error()))
+		}
+	}
+
+	if err := p.stopAndRemoveContainer(ctx, s.InfraID); err != nil {
+		op.Errorf("Failed to remove infra container for pod %s: %s", pod.Name, err.Error())
+		failures = append(failures, fmt.Sprintf("infra container: %s", err.Error()))
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("DeletePod: failed to tear down pod %s: %s", pod.Name, strings.Join(failures, "; "))
+	}
+
+	p.containerStore.delete(pod.UID)
+
+	return nil
+}
+
+// GetPod returns the last pod spec CreatePod/UpdatePod recorded for
+// namespace/name.
+func (p *PodProxy) GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error) {
+	s, ok := p.containerStore.getByName(namespace, name)
+	if !ok {
+		return nil, engerr.NotFoundError(name)
+	}
+
+	return s.Pod, nil
+}
+
+// GetPods returns every pod currently tracked by the containerStore.
+func (p *PodProxy) GetPods(ctx context.Context) ([]*v1.Pod, error) {
+	sandboxes := p.containerStore.list()
+
+	pods := make([]*v1.Pod, 0, len(sandboxes))
+	for _, s := range sandboxes {
+		pods = append(pods, s.Pod)
+	}
+
+	return pods, nil
+}
+
+// GetPodStatus reconstructs a v1.PodStatus from the containerStore, checking
+// each container's actual existence in the portlayer rather than assuming
+// whatever CreatePod recorded still holds.
+//
+// TODO: PodIP isn't set here; that needs the sandbox's scope endpoint address,
+// which IsolationProxy doesn't expose a way to look up yet.
+func (p *PodProxy) GetPodStatus(ctx context.Context, namespace, name string) (*v1.PodStatus, error) {
+	s, ok := p.containerStore.getByName(namespace, name)
+	if !ok {
+		return nil, engerr.NotFoundError(name)
+	}
+
+	status := &v1.PodStatus{
+		ContainerStatuses: make([]v1.ContainerStatus, 0, len(s.ContainerIDs)),
+	}
+
+	running, terminated := 0, 0
+
+	for name, id := range s.ContainerIDs {
+		state, isRunning := p.containerState(ctx, id)
+		if isRunning {
+			running++
+		} else {
+			terminated++
+		}
+
+		ready := isRunning
+		if isRunning && s.probedContainers[name] {
+			ready = p.healthMonitor.ContainerState(ctx, id) == proxy.HealthHealthy
+		}
+
+		status.ContainerStatuses = append(status.ContainerStatuses, v1.ContainerStatus{
+			Name:        name,
+			ContainerID: id,
+			ImageID:     s.ImageIDs[name],
+			// This provider has no restart-in-place mechanism yet (UpdatePod
+			// always deletes and recreates the whole pod), so a container
+			// this proxy still knows about has never been restarted.
+			RestartCount: 0,
+			Ready:        ready,
+			State:        state,
+		})
+	}
+
+	switch {
+	case len(s.ContainerIDs) > 0 && terminated == len(s.ContainerIDs):
+		status.Phase = v1.PodSucceeded
+	case running > 0:
+		status.Phase = v1.PodRunning
+	default:
+		status.Phase = v1.PodPending
+	}
+
+	return status, nil
+}
+
+// containerState reports the v1.ContainerState to report for id and whether
+// it's still running, by checking whether the portlayer still resolves a
+// handle for it - a container stopAndRemoveContainer has torn down, or that
+// exited/was removed out from under this provider, no longer will.
+func (p *PodProxy) containerState(ctx context.Context, id string) (v1.ContainerState, bool) {
+	if _, err := p.isolationProxy.Handle(ctx, id, id); err != nil {
+		return v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ContainerID: id},
+		}, false
+	}
+
+	return v1.ContainerState{Running: &v1.ContainerStateRunning{}}, true
+}
+
+// PodStats is a one-shot snapshot of a pod's and its containers' resource
+// usage, shaped so the kubelet GetStatsSummary endpoint can translate it
+// into the stats/v1alpha1 Summary's PodStats entry.
+type PodStats struct {
+	PodUID     k8stypes.UID
+	Namespace  string
+	Name       string
+	Timestamp  time.Time
+	Containers map[string]proxy.ContainerStat // container name -> sample
+}
+
+// GetPodStats samples every container in the pod once and aggregates the
+// results into a PodStats.  It relies on isolationProxy.ContainerStats, so it
+// returns an error if PodProxy wasn't constructed with one.
+func (p *PodProxy) GetPodStats(ctx context.Context, namespace, name string) (*PodStats, error) {
+	if p.isolationProxy == nil {
+		return nil, fmt.Errorf("PodProxy.GetPodStats: no IsolationProxy configured")
+	}
+
+	s, ok := p.containerStore.getByName(namespace, name)
+	if !ok {
+		return nil, engerr.NotFoundError(name)
+	}
+
+	stats := &PodStats{
+		PodUID:     s.Pod.UID,
+		Namespace:  namespace,
+		Name:       name,
+		Timestamp:  time.Now(),
+		Containers: make(map[string]proxy.ContainerStat, len(s.ContainerIDs)),
+	}
+
+	for cname, id := range s.ContainerIDs {
+		ch, err := p.isolationProxy.ContainerStats(ctx, id, false, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		stat, ok := <-ch
+		if !ok {
+			return nil, fmt.Errorf("PodProxy.GetPodStats: no stats sample returned for container %s", cname)
+		}
+		stats.Containers[cname] = stat
+	}
+
+	return stats, nil
+}
+
+// GetContainerLogs streams log output for a single container.
+func (p *PodProxy) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts ContainerLogOpts) (io.ReadCloser, error) {
+	if p.isolationProxy == nil {
+		return nil, fmt.Errorf("PodProxy.GetContainerLogs: no IsolationProxy configured")
+	}
+
+	s, ok := p.containerStore.getByName(namespace, podName)
+	if !ok {
+		return nil, engerr.NotFoundError(podName)
+	}
+
+	id, ok := s.ContainerIDs[containerName]
+	if !ok {
+		return nil, engerr.NotFoundError(containerName)
+	}
+
+	return p.isolationProxy.GetContainerLogs(ctx, id, opts.Follow, opts.Tail, opts.SinceSeconds, opts.Timestamps)
+}
+
+// RunInContainer (exec) isn't implemented yet: it needs an ad hoc Tasks
+// join/bind plus an Interaction attach scoped to that task, neither of which
+// IsolationProxy exposes today - see GetContainerLogs/AddLoggingToHandle and
+// AddInteractionToHandle for the primitives a real implementation would build
+// on. It stays on VicPodProxy rather than being dropped so callers get a
+// clear, explicit error instead of a missing capability.
+func (p *PodProxy) RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	return fmt.Errorf("PodProxy.RunInContainer: exec is not implemented yet")
+}
+
+// teardownPartialPod stops and removes every container already created for a
+// pod whose CreatePod failed partway through, so a failed create doesn't
+// leave orphaned sibling and infra containers (or their readiness probe
+// goroutines) running with nothing in the containerStore to ever clean them
+// up through DeletePod.
+func (p *PodProxy) teardownPartialPod(ctx context.Context, infraID string, containerIDs map[string]string, probedContainers map[string]bool) {
+	op := trace.FromContext(ctx, "teardownPartialPod")
+
+	for name, id := range containerIDs {
+		if probedContainers[name] {
+			p.healthMonitor.Stop(id)
+		}
+		if err := p.stopAndRemoveContainer(ctx, id); err != nil {
+			op.Errorf("Failed to remove container %s while tearing down a partially created pod: %s", name, err.Error())
+		}
+	}
+
+	if err := p.stopAndRemoveContainer(ctx, infraID); err != nil {
+		op.Errorf("Failed to remove infra container while tearing down a partially created pod: %s", err.Error())
+	}
+}
+
+// stopAndRemoveContainer stops and removes a single container by ID.
+func (p *PodProxy) stopAndRemoveContainer(ctx context.Context, id string) error {
+	op := trace.FromContext(ctx, "stopAndRemoveContainer")
+	op.Infof("stopAndRemoveContainer(%s)", id)
+
+	if p.isolationProxy == nil {
+		return fmt.Errorf("PodProxy.stopAndRemoveContainer: no IsolationProxy configured")
+	}
+
+	handle, err := p.isolationProxy.Handle(ctx, id, id)
+	if err != nil {
+		return err
+	}
+
+	handle, err = p.isolationProxy.SetState(ctx, handle, id, containerStateStopped)
+	if err != nil {
+		return err
+	}
+
+	if err := p.isolationProxy.CommitHandle(ctx, handle, id, 0); err != nil {
+		return err
+	}
+
+	if _, err := p.client.Containers.Delete(containers.NewDeleteParamsWithContext(ctx).WithID(id)); err != nil {
+		switch err := err.(type) {
+		case *containers.DeleteNotFound:
+			return engerr.NotFoundError(id)
+		case *containers.DeleteDefault:
+			return engerr.InternalServerError(err.Payload.Message)
+		default:
+			return engerr.InternalServerError(err.Error())
 		}
 	}
 
 	return nil
 }
 
-func (p *PodProxy) createContainer(ctx context.Context, config types.ContainerCreateConfig) error {
+// imagePullPolicy maps a container's Kubernetes imagePullPolicy onto the
+// image store's policy, defaulting to IfNotPresent as kubelet does for
+// containers that don't request "latest".
+func imagePullPolicy(cSpec v1.Container) proxy.ImagePullPolicy {
+	switch cSpec.ImagePullPolicy {
+	case v1.PullAlways:
+		return proxy.PullAlways
+	case v1.PullNever:
+		return proxy.PullNever
+	default:
+		return proxy.PullIfNotPresent
+	}
+}
+
+// createContainer builds and commits a single container's handle, returning
+// both its ID and the resolved image ID it was built from, so callers that
+// track per-container status (e.g. GetPodStatus's ContainerStatus.ImageID)
+// don't have to resolve the image a second time.
+func (p *PodProxy) createContainer(ctx context.Context, namespace string, pullSecrets []v1.LocalObjectReference, policy proxy.ImagePullPolicy, config types.ContainerCreateConfig) (string, string, error) {
 	op := trace.FromContext(ctx, "createContainer")
 
-	// Pull image config from VIC's image store
-	image, err := p.imageStore.Get(config.Config.Image)
+	if p.isolationProxy == nil {
+		return "", "", fmt.Errorf("PodProxy.createContainer: no IsolationProxy configured")
+	}
+
+	// Pull image config from VIC's image store, resolving imagePullSecrets
+	// and gating the pull with the container's imagePullPolicy. This is the
+	// one path that has namespace's imagePullSecrets resolved against a
+	// SecretLister, so it's used instead of a separate
+	// IsolationProxy.PullImage call here.
+	image, err := p.imageStore.Get(ctx, namespace, config.Config.Image, "", pullSecrets, policy, true)
 	if err != nil {
-		err = fmt.Errorf("PodProxy failed to get image %s's config from the image store: %s", err.Error())
+		err = fmt.Errorf("PodProxy failed to get image %s's config from the image store: %s", config.Config.Image, err.Error())
 		op.Error(err)
-		return err
+		return "", "", err
 	}
 
 	setCreateConfigOptions(config.Config, image.Config)
 	op.Infof("config = %#v", config.Config)
 
-	return nil
+	if err := validateCreateConfig(&config); err != nil {
+		return "", "", err
+	}
+
+	isoConfig := isolationConfigFromCreateConfig(namespace, config, image.ImageID)
+
+	containerID, err := p.isolationProxy.BuildContainerHandle(ctx, isoConfig, 0)
+	if err != nil {
+		op.Errorf("Failed to build container handle for %s: %s", config.Name, err.Error())
+		return "", "", err
+	}
+
+	return containerID, image.ImageID, nil
+}
+
+// isolationConfigFromCreateConfig translates a docker-shaped create config,
+// plus the image's resolved ID, into IsolationProxy's config shape.  LayerID
+// is approximated as imageID, matching IsolationProxy.PullImage's own TODO on
+// the subject.
+func isolationConfigFromCreateConfig(namespace string, config types.ContainerCreateConfig, imageID string) proxy.IsolationContainerConfig {
+	return proxy.IsolationContainerConfig{
+		ImageID:    imageID,
+		LayerID:    imageID,
+		ImageName:  config.Config.Image,
+		Name:       config.Name,
+		Namespace:  namespace,
+		Cmd:        config.Config.Cmd,
+		Entrypoint: config.Config.Entrypoint,
+		Env:        config.Config.Env,
+		WorkingDir: config.Config.WorkingDir,
+		User:       config.Config.User,
+		StopSignal: config.Config.StopSignal,
+		StdinOnce:  config.Config.StdinOnce,
+		OpenStdin:  config.Config.OpenStdin,
+		Tty:        config.Config.Tty,
+		CPUCount:   config.HostConfig.Resources.CPUCount,
+		Memory:     config.HostConfig.Resources.Memory,
+		Mounts:     dockerMountsToIsolationMounts(config.HostConfig.Mounts),
+		PortMap:    dockerPortBindingsToPortMap(config.HostConfig.PortBindings),
+	}
+}
+
+// dockerPortBindingsToPortMap converts docker's per-port binding list into
+// the single-binding-per-port shape proxy.IsolationContainerConfig.PortMap
+// expects; a port bound to more than one host port/interface only keeps the
+// first, same as containerSpecToCreateSpec only ever records one binding per
+// port today.
+func dockerPortBindingsToPortMap(bindings nat.PortMap) map[string]proxy.PortBinding {
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	portMap := make(map[string]proxy.PortBinding, len(bindings))
+	for port, bs := range bindings {
+		if len(bs) == 0 {
+			continue
+		}
+		portMap[string(port)] = proxy.PortBinding{
+			HostIP:   bs[0].HostIP,
+			HostPort: bs[0].HostPort,
+		}
+	}
+	return portMap
+}
+
+// dockerMountsToIsolationMounts converts the named-volume mounts produced by
+// kubeVolumesToDockerMounts into the proxy package's Mount shape, which
+// BuildContainerHandle joins to the container handle by volume name. There's
+// nothing to convert for HostPath volumes: they're rejected outright in
+// kubeVolumesToDockerMounts since VIC has no portlayer equivalent for binding
+// a host filesystem path into a container VM.
+func dockerMountsToIsolationMounts(mounts []mount.Mount) []proxy.Mount {
+	out := make([]proxy.Mount, 0, len(mounts))
+	for _, m := range mounts {
+		out = append(out, proxy.Mount{
+			Name:        m.Source,
+			Destination: m.Target,
+			ReadOnly:    m.ReadOnly,
+			Type:        string(m.Type),
+		})
+	}
+	return out
 }
 
 //------------------------------------
 // Utility Functions
 //------------------------------------
 
+// infraContainerSuffix names the pod's sandbox/infra container relative to
+// the pod name, similar to how CRI shims name the "pause" container.
+const infraContainerSuffix = "-infra"
+
+// podSpecToInfraCreateSpec builds the docker create config for a pod's
+// infra/sandbox container: the lightweight container that holds the pod's
+// shared network/IPC/PID namespaces, DNS config, hostname, and restart
+// policy, and that the pod's app containers are joined to.
+//
+// TODO: refactor so we no longer need to know about docker types
+func podSpecToInfraCreateSpec(pod *v1.Pod) types.ContainerCreateConfig {
+	config := types.ContainerCreateConfig{
+		Name: pod.Name + infraContainerSuffix,
+		Config: &container.Config{
+			Hostname: pod.Spec.Hostname,
+			Image:    DummyInfraImage,
+		},
+		HostConfig: &container.HostConfig{},
+	}
+
+	if pod.Spec.HostNetwork {
+		config.HostConfig.NetworkMode = "host"
+	}
+
+	//TODO: translate DNSPolicy/DNSConfig, hostAliases (ExtraHosts) and
+	//      shareProcessNamespace once the portlayer exposes equivalents.
+
+	return config
+}
+
+// containerSpecToCreateSpec builds the docker create config for one of a
+// pod's app containers, joined to the namespaces owned by the pod's infra
+// container so the containers share network/IPC/PID as Kubernetes expects.
+// podVolumes is the pod-level volume list so cSpec's volumeMounts can be
+// resolved against it.
+//
 // TODO: refactor so we no longer need to know about docker types
-func KubeSpecToDockerCreateSpec(cSpec v1.Container) types.ContainerCreateConfig {
+func containerSpecToCreateSpec(podUID k8stypes.UID, infraID string, podVolumes []v1.Volume, cSpec v1.Container) types.ContainerCreateConfig {
 	config := types.ContainerCreateConfig{
 		Name: cSpec.Name,
 		Config: &container.Config{
@@ -103,7 +739,9 @@ func KubeSpecToDockerCreateSpec(cSpec v1.Container) types.ContainerCreateConfig
 			OpenStdin:  cSpec.Stdin,
 		},
 		HostConfig: &container.HostConfig{
-		//container.Resources.CPUCount:
+			NetworkMode: container.NetworkMode(fmt.Sprintf("container:%s", infraID)),
+			IpcMode:     container.IpcMode(fmt.Sprintf("container:%s", infraID)),
+			PidMode:     container.PidMode(fmt.Sprintf("container:%s", infraID)),
 		},
 	}
 
@@ -116,9 +754,248 @@ func KubeSpecToDockerCreateSpec(cSpec v1.Container) types.ContainerCreateConfig
 	config.HostConfig.Resources.CPUCount = cSpec.Resources.Limits.Cpu().Value()
 	config.HostConfig.Resources.Memory = cSpec.Resources.Limits.Memory().Value()
 
+	mounts, err := kubeVolumesToDockerMounts(podUID, podVolumes, cSpec.VolumeMounts)
+	if err != nil {
+		// CreatePod checks cSpec's volumeMounts with kubeVolumesToDockerMounts
+		// before calling this and fails the pod on a bad reference, so here
+		// the error is only logged and the rest of the config is still built.
+		log.Errorf("Failed to translate volumes for container %s: %s", cSpec.Name, err.Error())
+	}
+	config.HostConfig.Mounts = mounts
+
+	config.Config.ExposedPorts, config.HostConfig.PortBindings = kubePortsToDockerPorts(cSpec.Name, cSpec.Ports)
+
+	config.Config.Healthcheck = kubeProbesToHealthcheck(cSpec)
+
 	return config
 }
 
+// kubePortsToDockerPorts translates a container's declared ports into
+// docker's ExposedPorts/PortBindings shape, the form isolationConfigFromCreateConfig
+// reads to build the IsolationContainerConfig.PortMap that addHandleToScopes
+// publishes through the container's scope attachment.
+func kubePortsToDockerPorts(containerName string, ports []v1.ContainerPort) (nat.PortSet, nat.PortMap) {
+	if len(ports) == 0 {
+		return nil, nil
+	}
+
+	exposedPorts := make(nat.PortSet, len(ports))
+	portBindings := make(nat.PortMap, len(ports))
+
+	for _, p := range ports {
+		proto := strings.ToLower(string(p.Protocol))
+		if proto == "" {
+			proto = "tcp"
+		}
+
+		port, err := nat.NewPort(proto, strconv.Itoa(int(p.ContainerPort)))
+		if err != nil {
+			log.Errorf("Failed to translate port %d/%s for container %s: %s", p.ContainerPort, proto, containerName, err.Error())
+			continue
+		}
+		exposedPorts[port] = struct{}{}
+
+		if p.HostPort != 0 {
+			portBindings[port] = append(portBindings[port], nat.PortBinding{
+				HostIP:   p.HostIP,
+				HostPort: strconv.Itoa(int(p.HostPort)),
+			})
+		}
+	}
+
+	return exposedPorts, portBindings
+}
+
+// provisionPodVolumes creates the VIC volumes backing pod's emptyDir and
+// persistentVolumeClaim volumes before any of its containers are created, so
+// the VolumeJoin calls BuildContainerHandle makes through
+// IsolationProxy.AddVolumesToHandle have a volume to join. A pod's
+// containers can reference the same emptyDir by name, so EnsureVolume is
+// idempotent rather than failing the second container's join with "already
+// exists".
+//
+// ConfigMap and Secret volumes aren't provisioned here: populating one needs
+// a Kubernetes API client to read the referenced object, which PodProxy
+// doesn't have wired up, and a way to project that data into a volume's
+// filesystem content, which IsolationProxy doesn't expose. Rather than join
+// an anonymous volume that was never populated, kubeVolumesToDockerMounts
+// rejects ConfigMap/Secret volumeMounts outright.
+func (p *PodProxy) provisionPodVolumes(ctx context.Context, pod *v1.Pod) error {
+	for _, vol := range pod.Spec.Volumes {
+		switch {
+		case vol.EmptyDir != nil:
+			spec := proxy.VolumeSpec{
+				Name: emptyDirVolumeName(pod.UID, vol.Name),
+				Kind: proxy.VolumeEphemeral,
+			}
+			if _, err := p.isolationProxy.EnsureVolume(ctx, spec); err != nil {
+				return fmt.Errorf("failed to provision emptyDir volume %q: %s", vol.Name, err.Error())
+			}
+
+		case vol.PersistentVolumeClaim != nil:
+			spec := proxy.VolumeSpec{
+				Name: vol.PersistentVolumeClaim.ClaimName,
+				Kind: proxy.VolumePersistent,
+			}
+			if _, err := p.isolationProxy.EnsureVolume(ctx, spec); err != nil {
+				return fmt.Errorf("failed to provision persistentVolumeClaim volume %q: %s", vol.PersistentVolumeClaim.ClaimName, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// kubeVolumesToDockerMounts resolves a container's volumeMounts against the
+// pod's volume list and produces the docker HostConfig.Mounts entries needed
+// to satisfy them.
+//
+//   - EmptyDir volumes become a named VIC volume scoped to the pod; it's
+//     shared across the pod's containers. provisionPodVolumes creates it
+//     ahead of any container's join; DeletePod does not remove it.
+//   - PersistentVolumeClaim volumes resolve to a named VIC volume using the
+//     claim name, likewise provisioned by provisionPodVolumes.
+//   - ConfigMap/Secret volumes are rejected; see provisionPodVolumes for why.
+//   - HostPath volumes are rejected: VIC containers are isolated VMs with no
+//     access to the host filesystem, so there's no portlayer mount
+//     equivalent for a host path the way there is for a named volume.
+//
+// SubPath has no equivalent for named (volume-type) mounts under the
+// persona's pinned Docker API version, so it's rejected rather than silently
+// mounting the whole volume.
+func kubeVolumesToDockerMounts(podUID k8stypes.UID, podVolumes []v1.Volume, mounts []v1.VolumeMount) ([]mount.Mount, error) {
+	volumesByName := make(map[string]v1.Volume, len(podVolumes))
+	for _, vol := range podVolumes {
+		volumesByName[vol.Name] = vol
+	}
+
+	var dockerMounts []mount.Mount
+
+	for _, vm := range mounts {
+		vol, ok := volumesByName[vm.Name]
+		if !ok {
+			return nil, fmt.Errorf("volumeMount %q references undeclared volume", vm.Name)
+		}
+
+		switch {
+		case vol.HostPath != nil:
+			return nil, fmt.Errorf("volumeMount %q: hostPath volumes are not supported", vm.Name)
+
+		case vol.EmptyDir != nil:
+			if vm.SubPath != "" {
+				return nil, fmt.Errorf("volumeMount %q: subPath is not supported for emptyDir volumes", vm.Name)
+			}
+			dockerMounts = append(dockerMounts, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   emptyDirVolumeName(podUID, vm.Name),
+				Target:   vm.MountPath,
+				ReadOnly: vm.ReadOnly,
+			})
+
+		case vol.PersistentVolumeClaim != nil:
+			if vm.SubPath != "" {
+				return nil, fmt.Errorf("volumeMount %q: subPath is not supported for persistentVolumeClaim volumes", vm.Name)
+			}
+			dockerMounts = append(dockerMounts, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   vol.PersistentVolumeClaim.ClaimName,
+				Target:   vm.MountPath,
+				ReadOnly: vm.ReadOnly,
+			})
+
+		case vol.ConfigMap != nil:
+			return nil, fmt.Errorf("volumeMount %q: configMap volumes are not supported", vm.Name)
+
+		case vol.Secret != nil:
+			return nil, fmt.Errorf("volumeMount %q: secret volumes are not supported", vm.Name)
+
+		default:
+			return nil, fmt.Errorf("volume %q uses an unsupported volume source", vm.Name)
+		}
+	}
+
+	return dockerMounts, nil
+}
+
+// emptyDirVolumeName scopes an emptyDir's backing VIC volume name by podUID
+// ("<podUID>-emptydir-<name>"), so that two pods' same-named emptyDir
+// volumes never collide on one volume.
+func emptyDirVolumeName(podUID k8stypes.UID, mountName string) string {
+	return fmt.Sprintf("%s-emptydir-%s", podUID, mountName)
+}
+
+// kubeProbesToHealthcheck maps cSpec's liveness probe to Docker's single
+// HealthConfig, the closest equivalent VIC has.  Readiness is tracked
+// separately by PodProxy.healthMonitor since Docker's model has no notion of it.
+// If a startup probe is present, liveness failures are suppressed for the
+// startup probe's worst-case duration by extending StartPeriod, so a slow
+// starting container isn't killed by the liveness check before it's had a
+// chance to start.
+func kubeProbesToHealthcheck(cSpec v1.Container) *container.HealthConfig {
+	hc := probeToHealthConfig(cSpec.LivenessProbe)
+	if hc == nil {
+		return nil
+	}
+
+	if sp := cSpec.StartupProbe; sp != nil {
+		startupWindow := time.Duration(sp.InitialDelaySeconds)*time.Second +
+			time.Duration(sp.PeriodSeconds)*time.Duration(sp.FailureThreshold)*time.Second
+		if startupWindow > hc.StartPeriod {
+			hc.StartPeriod = startupWindow
+		}
+	}
+
+	return hc
+}
+
+// probeToHealthConfig translates a single Kubernetes probe into Docker's
+// HealthConfig shape.
+func probeToHealthConfig(probe *v1.Probe) *container.HealthConfig {
+	if probe == nil {
+		return nil
+	}
+
+	hc := &container.HealthConfig{
+		Interval:    time.Duration(probe.PeriodSeconds) * time.Second,
+		Timeout:     time.Duration(probe.TimeoutSeconds) * time.Second,
+		StartPeriod: time.Duration(probe.InitialDelaySeconds) * time.Second,
+		Retries:     int(probe.FailureThreshold),
+	}
+
+	switch {
+	case probe.Exec != nil:
+		hc.Test = append([]string{"CMD-SHELL"}, strings.Join(probe.Exec.Command, " "))
+
+	case probe.HTTPGet != nil:
+		cmd := fmt.Sprintf("curl -fsS %shttp://127.0.0.1:%d%s",
+			httpHeaderFlags(probe.HTTPGet.HTTPHeaders), probe.HTTPGet.Port.IntValue(), probe.HTTPGet.Path)
+		hc.Test = []string{"CMD-SHELL", cmd}
+
+	case probe.TCPSocket != nil:
+		cmd := fmt.Sprintf("sh -c \"</dev/tcp/127.0.0.1/%d\"", probe.TCPSocket.Port.IntValue())
+		hc.Test = []string{"CMD-SHELL", cmd}
+
+	default:
+		return nil
+	}
+
+	return hc
+}
+
+// httpHeaderFlags renders a probe's custom HTTP headers as curl -H flags,
+// with a trailing space so it can be concatenated directly before the URL.
+func httpHeaderFlags(headers []v1.HTTPHeader) string {
+	if len(headers) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, h := range headers {
+		fmt.Fprintf(&b, "-H '%s: %s' ", h.Name, h.Value)
+	}
+	return b.String()
+}
+
 // SetConfigOptions is a place to add necessary container configuration
 // values that were not explicitly supplied by the user
 func setCreateConfigOptions(config, imageConfig *container.Config) {
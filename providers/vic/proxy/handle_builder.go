@@ -0,0 +1,294 @@
+// Copyright 2018 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/containers"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/scopes"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/storage"
+	"github.com/vmware/vic/lib/apiservers/portlayer/models"
+	"github.com/vmware/vic/pkg/trace"
+)
+
+// undoRetries/undoRetryDelay bound how hard a HandleBuilder retries a single
+// compensation before giving up and moving on to the rest of the stack; a
+// stuck compensation must not block cleanup of everything below it.
+const (
+	undoRetries    = 3
+	undoRetryDelay = 200 * time.Millisecond
+)
+
+// compensation is one undoable step recorded by HandleBuilder, run in
+// reverse order of how its step was applied.
+type compensation struct {
+	name string
+	undo func(ctx context.Context) error
+}
+
+// HandleBuilder assembles a container handle through the portlayer's
+// multi-step join pipeline (image, task, networks, volumes, interaction,
+// logging, commit), recording a compensation for each successful step. If
+// any step - including Commit itself - fails, the builder walks every
+// recorded compensation in reverse, so a partially built handle never leaks
+// orphaned portlayer state.
+type HandleBuilder struct {
+	proxy *VicIsolationProxy
+
+	containerID string
+	handle      string
+	undo        []compensation
+	err         error
+}
+
+// NewHandleBuilder starts a build by creating the base handle for config.
+// If CreateHandle fails there's nothing to build on, so the returned
+// builder carries the error and every subsequent With* call is a no-op.
+func (v *VicIsolationProxy) NewHandleBuilder(ctx context.Context, config IsolationContainerConfig) *HandleBuilder {
+	b := &HandleBuilder{proxy: v}
+
+	id, handle, err := v.CreateHandle(ctx, config)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	b.containerID = id
+	b.handle = handle
+	b.pushUndo("delete base container", func(ctx context.Context) error {
+		_, err := v.client.Containers.Delete(containers.NewDeleteParamsWithContext(ctx).WithID(id))
+		return err
+	})
+
+	return b
+}
+
+// Err returns the first error encountered by the build, if any.
+func (b *HandleBuilder) Err() error {
+	return b.err
+}
+
+// Handle returns the current handle. It's only meaningful while Err() is nil.
+func (b *HandleBuilder) Handle() string {
+	return b.handle
+}
+
+// AddCompensation lets callers above IsolationProxy (e.g. pod-creation code
+// that opened a temp file to project a Secret into a volume) fold their own
+// cleanup into this build's rollback, so one failure anywhere unwinds
+// everything.
+func (b *HandleBuilder) AddCompensation(name string, undo func(ctx context.Context) error) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.pushUndo(name, undo)
+	return b
+}
+
+func (b *HandleBuilder) pushUndo(name string, undo func(ctx context.Context) error) {
+	b.undo = append(b.undo, compensation{name: name, undo: undo})
+}
+
+// WithImage joins the image layer identified by deltaID/layerID/imageID to
+// the handle.
+func (b *HandleBuilder) WithImage(ctx context.Context, deltaID, layerID, imageID, imageName string) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, err := b.proxy.AddImageToHandle(ctx, b.handle, deltaID, layerID, imageID, imageName)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	// There's no portlayer "detach image" call distinct from discarding the
+	// handle itself; deleting the base container (already on the stack)
+	// releases the image join along with it.
+	return b
+}
+
+// WithTask joins the primary process task described by config to the
+// handle.
+func (b *HandleBuilder) WithTask(ctx context.Context, id, layerID string, config IsolationContainerConfig) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, err := b.proxy.CreateHandleTask(ctx, b.handle, id, layerID, config)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	return b
+}
+
+// WithNetworks attaches the handle to every network in config.Networks (or
+// the degenerate PortMap-only default, as AddHandleToScope does), recording
+// a RemoveContainer compensation per scope so a later failure unwinds every
+// attachment this call made, not just the last one.
+func (b *HandleBuilder) WithNetworks(ctx context.Context, config IsolationContainerConfig) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, scopeNames, err := b.proxy.addHandleToScopes(ctx, b.handle, config)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	for _, scope := range scopeNames {
+		scope := scope
+		b.pushUndo("leave scope "+scope, func(ctx context.Context) error {
+			// Rollback only ever runs before Commit succeeds, so containerID
+			// was never actually committed into existence; only the live
+			// handle token is valid to operate against here. RemoveContainer
+			// returns a new handle that must be carried into b.handle before
+			// the next compensation runs, or it'll operate on a stale token.
+			res, err := b.proxy.client.Scopes.RemoveContainer(scopes.NewRemoveContainerParamsWithContext(ctx).WithHandle(b.handle).WithScope(scope))
+			if err != nil {
+				return err
+			}
+			b.handle = res.Payload
+			return nil
+		})
+	}
+
+	return b
+}
+
+// WithVolumes joins each mount to the handle, recording a VolumeLeave
+// compensation per mount that actually got joined. addVolumesToHandle rolls
+// back any partial join itself before returning an error, so the only case
+// WithVolumes needs to record compensations for is every mount succeeding.
+func (b *HandleBuilder) WithVolumes(ctx context.Context, mounts []Mount) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, joined, err := b.proxy.addVolumesToHandle(ctx, b.handle, mounts)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	for _, m := range joined {
+		m := m
+		b.pushUndo("leave volume "+m.Name, func(ctx context.Context) error {
+			// See the WithNetworks compensation above: only the live handle
+			// token is valid here, not containerID, and it must be carried
+			// forward into b.handle for the next compensation in the stack.
+			res, err := b.proxy.client.Storage.VolumeLeave(storage.NewVolumeLeaveParamsWithContext(ctx).
+				WithName(m.Name).
+				WithJoinArgs(&models.VolumeLeaveConfig{Handle: b.handle}))
+			if err != nil {
+				return err
+			}
+			handle, ok := res.Payload.Handle.(string)
+			if !ok {
+				return fmt.Errorf("VolumeLeave: type assertion failed for %#+v", res.Payload.Handle)
+			}
+			b.handle = handle
+			return nil
+		})
+	}
+
+	return b
+}
+
+// WithInteraction adds interaction capability to the handle.
+func (b *HandleBuilder) WithInteraction(ctx context.Context) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, err := b.proxy.AddInteractionToHandle(ctx, b.handle)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	return b
+}
+
+// WithLogging adds logging capability to the handle.
+func (b *HandleBuilder) WithLogging(ctx context.Context) *HandleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	handle, err := b.proxy.AddLoggingToHandle(ctx, b.handle)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.handle = handle
+
+	return b
+}
+
+// Commit finalizes the handle. If any prior With* call failed, or Commit
+// itself fails, every recorded compensation is run in reverse order against
+// a fresh context before the error is returned, so callers never have to
+// clean up a partially built handle themselves.
+func (b *HandleBuilder) Commit(ctx context.Context, waitTime int32) error {
+	if b.err == nil {
+		b.err = b.proxy.CommitHandle(ctx, b.handle, b.containerID, waitTime)
+	}
+
+	if b.err != nil {
+		b.rollback()
+		return b.err
+	}
+
+	return nil
+}
+
+// rollback walks the undo stack in reverse, attempting each compensation up
+// to undoRetries times against a fresh, uncancelled context so the outer
+// operation's ctx being done doesn't skip cleanup.
+func (b *HandleBuilder) rollback() {
+	op := trace.NewOperation(context.Background(), "HandleBuilder.rollback")
+
+	for i := len(b.undo) - 1; i >= 0; i-- {
+		step := b.undo[i]
+
+		var err error
+		for attempt := 0; attempt < undoRetries; attempt++ {
+			undoCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err = step.undo(undoCtx)
+			cancel()
+
+			if err == nil {
+				break
+			}
+			time.Sleep(undoRetryDelay)
+		}
+
+		if err != nil {
+			op.Errorf("HandleBuilder.rollback: giving up on compensation %q after %d attempts: %s", step.name, undoRetries, err.Error())
+		}
+	}
+}
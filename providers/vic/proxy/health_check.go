@@ -0,0 +1,264 @@
+// Copyright 2018 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vmware/vic/pkg/trace"
+)
+
+// ProbeType names the Kubernetes probe mechanism a ProbeSpec evaluates.
+type ProbeType string
+
+const (
+	ProbeExec ProbeType = "exec"
+	ProbeHTTP ProbeType = "http"
+	ProbeTCP  ProbeType = "tcp"
+)
+
+// ProbeSpec is the portlayer-facing shape of a Kubernetes liveness/readiness/
+// startup probe, independent of which of the three it backs.
+type ProbeSpec struct {
+	Type ProbeType
+
+	// Exec
+	Command []string
+
+	// HTTP
+	HTTPPath string
+	Host     string
+	Port     int
+
+	InitialDelay     time.Duration
+	Period           time.Duration
+	Timeout          time.Duration
+	SuccessThreshold int
+	FailureThreshold int
+}
+
+// HealthCheckRun evaluates probe once against the container referenced by
+// handle and reports whether it succeeded.
+func (v *VicIsolationProxy) HealthCheckRun(ctx context.Context, handle string, probe ProbeSpec) (bool, error) {
+	op := trace.FromContext(ctx, "HealthCheckRun")
+	defer trace.End(trace.Begin(handle, op))
+
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch probe.Type {
+	case ProbeExec:
+		return v.execProbe(runCtx, handle, probe)
+	case ProbeHTTP:
+		return v.httpProbe(runCtx, probe)
+	case ProbeTCP:
+		return v.tcpProbe(runCtx, probe)
+	default:
+		return false, fmt.Errorf("HealthCheckRun: unknown probe type %q", probe.Type)
+	}
+}
+
+// execProbe would run probe.Command as a secondary task joined to handle and
+// report success if the task exits zero.
+//
+// That needs more than Tasks.Join/Bind: the container's handle would have to
+// be committed for the task to actually run, its exit code read back over
+// the interaction channel, and the task unbound and the handle committed
+// again afterward to clean up - none of which is wired up. Rather than
+// join/bind a task that's never started or cleaned up, exec probes are
+// rejected outright with an error. HealthMonitor counts that error as a
+// failed check, so an exec-probed container ends up HealthUnhealthy.
+func (v *VicIsolationProxy) execProbe(ctx context.Context, handle string, probe ProbeSpec) (bool, error) {
+	return false, fmt.Errorf("execProbe: exec-type probes are not supported yet")
+}
+
+// httpProbe issues an HTTP GET against probe.Host:probe.Port/probe.HTTPPath
+// and reports success on a 2xx/3xx response. The dial uses this process's
+// own network stack, which is the VCH's when the provider runs inside the
+// VCH appliance as intended; reaching a container over that stack depends on
+// probe.Host already naming something resolvable from there, such as the
+// container's name or ID through the VCH's embedded per-scope DNS -
+// kubeProbeToProbeSpec is responsible for filling in that fallback when the
+// pod spec left HTTPGet.Host/TCPSocket.Host empty.
+func (v *VicIsolationProxy) httpProbe(ctx context.Context, probe ProbeSpec) (bool, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", probe.Host, probe.Port))
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	req := fmt.Sprintf("GET %s HTTP/1.0\r\nHost: %s\r\n\r\n", probe.HTTPPath, probe.Host)
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return false, nil
+	}
+
+	buf := make([]byte, 12)
+	if _, err := conn.Read(buf); err != nil {
+		return false, nil
+	}
+
+	// "HTTP/1.x 2.." or "HTTP/1.x 3.."
+	return len(buf) >= 9 && (buf[9] == '2' || buf[9] == '3'), nil
+}
+
+// tcpProbe dials probe.Host:probe.Port and reports success if the connection
+// opens. See httpProbe above for what probe.Host needs to resolve to.
+func (v *VicIsolationProxy) tcpProbe(ctx context.Context, probe ProbeSpec) (bool, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", probe.Host, probe.Port))
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	return true, nil
+}
+
+// HealthState is the rolling state HealthMonitor tracks for a container.
+type HealthState string
+
+const (
+	HealthStarting  HealthState = "Starting"
+	HealthHealthy   HealthState = "Healthy"
+	HealthUnhealthy HealthState = "Unhealthy"
+)
+
+// HealthMonitor runs one probe-evaluation goroutine per monitored container
+// and records its rolling HealthState, consulted via ContainerState.
+type HealthMonitor struct {
+	proxy IsolationProxy
+
+	mu     sync.RWMutex
+	state  map[string]HealthState
+	cancel map[string]context.CancelFunc
+}
+
+// NewHealthMonitor creates a HealthMonitor that evaluates probes through
+// proxy.
+func NewHealthMonitor(proxy IsolationProxy) *HealthMonitor {
+	return &HealthMonitor{
+		proxy:  proxy,
+		state:  make(map[string]HealthState),
+		cancel: make(map[string]context.CancelFunc),
+	}
+}
+
+// Start begins evaluating probe against handle every probe.Period, counting
+// probe.SuccessThreshold/FailureThreshold consecutive results before
+// flipping state, until ctx is cancelled or Stop is called for handle.
+func (m *HealthMonitor) Start(ctx context.Context, handle string, probe ProbeSpec) {
+	runCtx, cancel := context.WithCancel(ctx)
+
+	m.mu.Lock()
+	if prev, ok := m.cancel[handle]; ok {
+		prev()
+	}
+	m.cancel[handle] = cancel
+	m.state[handle] = HealthStarting
+	m.mu.Unlock()
+
+	go m.run(runCtx, handle, probe)
+}
+
+func (m *HealthMonitor) run(ctx context.Context, handle string, probe ProbeSpec) {
+	if probe.InitialDelay > 0 {
+		select {
+		case <-time.After(probe.InitialDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	period := probe.Period
+	if period <= 0 {
+		period = 10 * time.Second
+	}
+	successThreshold := probe.SuccessThreshold
+	if successThreshold <= 0 {
+		successThreshold = 1
+	}
+	failureThreshold := probe.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = 3
+	}
+
+	var consecutiveSuccesses, consecutiveFailures int
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		ok, _ := m.proxy.HealthCheckRun(ctx, handle, probe)
+		if ok {
+			consecutiveSuccesses++
+			consecutiveFailures = 0
+			if consecutiveSuccesses >= successThreshold {
+				m.setState(handle, HealthHealthy)
+			}
+		} else {
+			consecutiveFailures++
+			consecutiveSuccesses = 0
+			if consecutiveFailures >= failureThreshold {
+				m.setState(handle, HealthUnhealthy)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *HealthMonitor) setState(handle string, state HealthState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state[handle] = state
+}
+
+// Stop cancels the monitoring goroutine for handle, if any, and drops its
+// recorded state.
+func (m *HealthMonitor) Stop(handle string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cancel, ok := m.cancel[handle]; ok {
+		cancel()
+		delete(m.cancel, handle)
+	}
+	delete(m.state, handle)
+}
+
+// ContainerState returns the last recorded HealthState for handle, or
+// HealthStarting if it isn't being monitored yet.
+func (m *HealthMonitor) ContainerState(ctx context.Context, handle string) HealthState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state, ok := m.state[handle]
+	if !ok {
+		return HealthStarting
+	}
+	return state
+}
@@ -17,54 +17,140 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vmware/vic/lib/apiservers/engine/backends/cache"
+	"github.com/vmware/vic/lib/apiservers/engine/errors"
 	"github.com/vmware/vic/lib/apiservers/portlayer/client"
 	"github.com/vmware/vic/lib/metadata"
 	"github.com/vmware/vic/pkg/trace"
+
+	"k8s.io/api/core/v1"
+)
+
+// ImagePullPolicy mirrors the Kubernetes container imagePullPolicy values
+// and gates whether Get actuates a pull and whether the image cache is
+// consulted first.
+type ImagePullPolicy string
+
+const (
+	PullAlways       ImagePullPolicy = "Always"
+	PullIfNotPresent ImagePullPolicy = "IfNotPresent"
+	PullNever        ImagePullPolicy = "Never"
 )
 
+// RegistryAuth carries the credentials for a single registry, resolved from
+// a pod's imagePullSecrets, in the same shape as Docker's AuthConfig.
+type RegistryAuth struct {
+	Username      string
+	Password      string
+	IdentityToken string
+	RegistryToken string
+	ServerAddress string
+}
+
+// SecretLister is the minimal Kubernetes Secret access ImageStore needs to
+// resolve imagePullSecrets; it's satisfied by a client-go SecretLister or a
+// thin wrapper around the API server.
+type SecretLister interface {
+	GetSecret(namespace, name string) (*v1.Secret, error)
+}
+
 type ImageStore interface {
-	Get(ctx context.Context, idOrRef, tag string, actuate bool) (*metadata.ImageConfig, error)
+	// Get returns an ImageConfig, resolving pullSecrets against namespace and
+	// gating the pull with policy.  If the config is not cached, VicImageStore
+	// can request imagec to pull the image if actuate is set to true.
+	Get(ctx context.Context, namespace, idOrRef, tag string, pullSecrets []v1.LocalObjectReference, policy ImagePullPolicy, actuate bool) (*metadata.ImageConfig, error)
 	GetImages(ctx context.Context) []*metadata.ImageConfig
-	PullImage(ctx context.Context, image, tag, username, password string) error
+	PullImage(ctx context.Context, image, tag string, auth RegistryAuth) error
+	// PullAndResolve pulls ref with auth already resolved by the caller (e.g.
+	// from a pod's imagePullSecrets) and returns its ImageConfig, short-
+	// circuiting the pull if ref was already pulled through it.
+	PullAndResolve(ctx context.Context, ref string, auth RegistryAuth) (*metadata.ImageConfig, error)
 }
 
+// ShortNameMode controls how VicImageStore resolves bare image references
+// (e.g. "nginx") that don't name an explicit registry.
+type ShortNameMode string
+
+const (
+	// ShortNameEnforcing rejects short names that don't match a configured
+	// alias.
+	ShortNameEnforcing ShortNameMode = "enforcing"
+	// ShortNamePermissive leaves unaliased short names untouched and lets
+	// the persona apply whatever default resolution it has configured.
+	ShortNamePermissive ShortNameMode = "permissive"
+	// ShortNameDockerHubOnly rewrites unaliased short names to their
+	// docker.io equivalent.
+	ShortNameDockerHubOnly ShortNameMode = "docker-hub-only"
+)
+
 type VicImageStore struct {
-	client        *client.PortLayer
-	personaAddr   string
-	portlayerAddr string
+	client           *client.PortLayer
+	personaAddr      string
+	portlayerAddr    string
+	secrets          SecretLister
+	shortNameMode    ShortNameMode
+	shortNameAliases map[string]string
+
+	pulledMu sync.Mutex
+	pulled   map[string]*metadata.ImageConfig // resolved ref -> cached pull result
 }
 
-func NewImageStore(plClient *client.PortLayer, personaAddr, portlayerAddr string) (ImageStore, error) {
+func NewImageStore(plClient *client.PortLayer, personaAddr, portlayerAddr string, secrets SecretLister, shortNameMode ShortNameMode, shortNameAliases map[string]string) (ImageStore, error) {
 	err := cache.InitializeImageCache(plClient)
 	if err != nil {
 		return nil, err
 	}
 
 	vs := &VicImageStore{
-		client:        plClient,
-		personaAddr:   personaAddr,
-		portlayerAddr: portlayerAddr,
+		client:           plClient,
+		personaAddr:      personaAddr,
+		portlayerAddr:    portlayerAddr,
+		secrets:          secrets,
+		shortNameMode:    shortNameMode,
+		shortNameAliases: shortNameAliases,
+		pulled:           make(map[string]*metadata.ImageConfig),
 	}
 
 	return vs, nil
 }
 
 // Get returns an ImageConfig.  If the config is not cached, VicImageStore can request
-// imagec to pull the image if actuate is set to true.
-func (v *VicImageStore) Get(ctx context.Context, idOrRef, tag string, actuate bool) (*metadata.ImageConfig, error) {
+// imagec to pull the image if actuate is set to true and policy allows it.
+func (v *VicImageStore) Get(ctx context.Context, namespace, idOrRef, tag string, pullSecrets []v1.LocalObjectReference, policy ImagePullPolicy, actuate bool) (*metadata.ImageConfig, error) {
 	op := trace.FromContext(ctx, "Get - %s:%s", idOrRef, tag)
 	defer trace.End(trace.Begin("", op))
 
-	c, err := cache.ImageCache().Get(idOrRef)
-	if err != nil && actuate {
-		err = v.PullImage(ctx, idOrRef, tag, "", "")
-		if err == nil {
+	idOrRef, err := v.resolveShortName(idOrRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == PullNever {
+		actuate = false
+	}
+
+	var c *metadata.ImageConfig
+	if policy != PullAlways {
+		c, err = cache.ImageCache().Get(idOrRef)
+	}
+
+	if (err != nil || c == nil) && actuate {
+		auth, aerr := v.resolveAuth(namespace, pullSecrets, idOrRef)
+		if aerr != nil {
+			op.Errorf("Failed to resolve imagePullSecrets for %s: %s", idOrRef, aerr.Error())
+			return nil, aerr
+		}
+
+		if err = v.PullImage(ctx, idOrRef, tag, auth); err == nil {
 			c, err = cache.ImageCache().Get(idOrRef)
 			if err != nil {
 				return nil, err
@@ -72,6 +158,13 @@ func (v *VicImageStore) Get(ctx context.Context, idOrRef, tag string, actuate bo
 		}
 	}
 
+	if c == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.NotFoundError(fmt.Sprintf("%s (pull disallowed by imagePullPolicy)", idOrRef))
+	}
+
 	return c, nil
 }
 
@@ -84,11 +177,17 @@ func (v *VicImageStore) GetImages(ctx context.Context) []*metadata.ImageConfig {
 
 // PullImage pulls images using the docker persona.  It simply issues a pull rest call to the persona.
 // This lets the persona be the imagec server and keeps both the kubelet and docker persona up to date
-// when the kubelet pulls an image.
-func (v *VicImageStore) PullImage(ctx context.Context, image, tag, username, password string) error {
+// when the kubelet pulls an image.  Registry credentials, if any, are forwarded via the X-Registry-Auth
+// header exactly as the Docker Engine API expects.
+func (v *VicImageStore) PullImage(ctx context.Context, image, tag string, auth RegistryAuth) error {
 	op := trace.FromContext(ctx, "Get - %s:%s", image, tag)
 	defer trace.End(trace.Begin("", op))
 
+	image, err := v.resolveShortName(image)
+	if err != nil {
+		return err
+	}
+
 	pullClient := &http.Client{Timeout: 60 * time.Second}
 	var personaServer string
 	if tag == "" {
@@ -98,7 +197,23 @@ func (v *VicImageStore) PullImage(ctx context.Context, image, tag, username, pas
 	}
 	op.Infof("POST %s", personaServer)
 	reader := bytes.NewBuffer([]byte(""))
-	resp, err := pullClient.Post(personaServer, "application/json", reader)
+	req, err := http.NewRequest(http.MethodPost, personaServer, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	if auth.Username != "" || auth.Password != "" || auth.IdentityToken != "" || auth.RegistryToken != "" {
+		encodedAuth, err := encodeRegistryAuth(auth)
+		if err != nil {
+			op.Errorf("Failed to encode registry auth for %s: %s", image, err.Error())
+			return err
+		}
+		req.Header.Set("X-Registry-Auth", encodedAuth)
+	}
+
+	resp, err := pullClient.Do(req)
 	if err != nil {
 		op.Errorf("Error from docker pull: error = %s", err.Error())
 		return err
@@ -121,3 +236,231 @@ func (v *VicImageStore) PullImage(ctx context.Context, image, tag, username, pas
 
 	return nil
 }
+
+// PullAndResolve pulls ref with auth already resolved by the caller and
+// returns its ImageConfig.  A ref that's already been pulled once is served
+// out of the pulled cache, keyed by the resolved ref, rather than re-pulled.
+func (v *VicImageStore) PullAndResolve(ctx context.Context, ref string, auth RegistryAuth) (*metadata.ImageConfig, error) {
+	op := trace.FromContext(ctx, "PullAndResolve - %s", ref)
+	defer trace.End(trace.Begin("", op))
+
+	ref, err := v.resolveShortName(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	v.pulledMu.Lock()
+	if c, ok := v.pulled[ref]; ok {
+		v.pulledMu.Unlock()
+		return c, nil
+	}
+	v.pulledMu.Unlock()
+
+	if err := v.PullImage(ctx, ref, "", auth); err != nil {
+		return nil, err
+	}
+
+	c, err := cache.ImageCache().Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	v.pulledMu.Lock()
+	v.pulled[ref] = c
+	v.pulledMu.Unlock()
+
+	return c, nil
+}
+
+// encodeRegistryAuth base64-encodes auth as the JSON document the Docker
+// Engine API expects in the X-Registry-Auth header.
+func encodeRegistryAuth(auth RegistryAuth) (string, error) {
+	buf, err := json.Marshal(struct {
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken,omitempty"`
+		RegistryToken string `json:"registrytoken,omitempty"`
+		ServerAddress string `json:"serveraddress"`
+	}{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+		RegistryToken: auth.RegistryToken,
+		ServerAddress: auth.ServerAddress,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+//------------------------------------
+// imagePullSecrets resolution
+//------------------------------------
+
+// dockerConfigJSON is the shape of a kubernetes.io/dockerconfigjson secret's
+// .dockerconfigjson key.
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// dockerConfigEntry is the shape of a kubernetes.io/dockercfg secret, and of
+// each value in a dockerConfigJSON's Auths map.
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// resolveAuth reads namespace's pullSecrets and returns the RegistryAuth
+// matching image's registry.  It returns a zero-value RegistryAuth, not an
+// error, when no secret has a matching entry, so callers can still attempt
+// an anonymous pull.
+func (v *VicImageStore) resolveAuth(namespace string, pullSecrets []v1.LocalObjectReference, image string) (RegistryAuth, error) {
+	if len(pullSecrets) == 0 || v.secrets == nil {
+		return RegistryAuth{}, nil
+	}
+
+	host := registryHost(image)
+
+	for _, ref := range pullSecrets {
+		secret, err := v.secrets.GetSecret(namespace, ref.Name)
+		if err != nil {
+			return RegistryAuth{}, fmt.Errorf("unable to resolve imagePullSecret %q: %s", ref.Name, err.Error())
+		}
+
+		entries, err := dockerConfigEntries(secret)
+		if err != nil {
+			return RegistryAuth{}, fmt.Errorf("unable to parse imagePullSecret %q: %s", ref.Name, err.Error())
+		}
+
+		if entry, addr, ok := matchRegistryEntry(entries, host); ok {
+			return registryAuthFromEntry(entry, addr), nil
+		}
+	}
+
+	return RegistryAuth{}, nil
+}
+
+// dockerConfigEntries extracts the per-registry auth entries from either a
+// kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg secret.
+func dockerConfigEntries(secret *v1.Secret) (map[string]dockerConfigEntry, error) {
+	if raw, ok := secret.Data[v1.DockerConfigJsonKey]; ok {
+		var cfg dockerConfigJSON
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, err
+		}
+		return cfg.Auths, nil
+	}
+
+	if raw, ok := secret.Data[v1.DockerConfigKey]; ok {
+		var entries map[string]dockerConfigEntry
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+
+	return nil, fmt.Errorf("secret %q has no %s or %s key", secret.Name, v1.DockerConfigJsonKey, v1.DockerConfigKey)
+}
+
+// matchRegistryEntry finds the dockerConfigEntry for host, trying the bare
+// host and the common "https://"/"http://" prefixed forms docker config
+// files use, plus the historical Docker Hub alias.
+func matchRegistryEntry(entries map[string]dockerConfigEntry, host string) (dockerConfigEntry, string, bool) {
+	candidates := []string{host, "https://" + host, "http://" + host}
+	if host == "docker.io" {
+		candidates = append(candidates, "https://index.docker.io/v1/")
+	}
+
+	for _, addr := range candidates {
+		if entry, ok := entries[addr]; ok {
+			return entry, addr, true
+		}
+	}
+
+	return dockerConfigEntry{}, "", false
+}
+
+func registryAuthFromEntry(entry dockerConfigEntry, serverAddress string) RegistryAuth {
+	username, password := entry.Username, entry.Password
+	if username == "" && password == "" && entry.Auth != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(entry.Auth); err == nil {
+			if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+				username, password = parts[0], parts[1]
+			}
+		}
+	}
+
+	return RegistryAuth{
+		Username:      username,
+		Password:      password,
+		ServerAddress: serverAddress,
+	}
+}
+
+// registryHost returns the registry hostname a bare or qualified image
+// reference resolves against, defaulting to Docker Hub.
+func registryHost(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+
+	return "docker.io"
+}
+
+//------------------------------------
+// short-name resolution
+//------------------------------------
+
+// resolveShortName applies v.shortNameAliases, then v.shortNameMode, to ref.
+// Aliases are applied first regardless of mode; an unaliased reference that
+// already names an explicit registry is returned unchanged.
+func (v *VicImageStore) resolveShortName(ref string) (string, error) {
+	if alias, ok := v.shortNameAliases[ref]; ok {
+		return alias, nil
+	}
+
+	if hasExplicitRegistry(ref) {
+		return ref, nil
+	}
+
+	switch v.shortNameMode {
+	case ShortNameDockerHubOnly:
+		return qualifyDockerHub(ref), nil
+	case ShortNameEnforcing:
+		return "", fmt.Errorf("image reference %q is a short name and ShortNameMode is %q; configure a short-name alias for it (configured aliases: %s)",
+			ref, ShortNameEnforcing, strings.Join(aliasKeys(v.shortNameAliases), ", "))
+	case ShortNamePermissive, "":
+		return ref, nil
+	default:
+		return "", fmt.Errorf("unknown ShortNameMode %q", v.shortNameMode)
+	}
+}
+
+// hasExplicitRegistry reports whether ref's leading path component names a
+// registry (contains a "." or ":", or is "localhost") rather than being part
+// of a bare short name like "nginx" or "library/nginx".
+func hasExplicitRegistry(ref string) bool {
+	parts := strings.SplitN(ref, "/", 2)
+	return len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost")
+}
+
+// qualifyDockerHub rewrites a short name to its fully-qualified docker.io
+// equivalent, adding the "library/" namespace for official images.
+func qualifyDockerHub(ref string) string {
+	if strings.Contains(ref, "/") {
+		return "docker.io/" + ref
+	}
+	return "docker.io/library/" + ref
+}
+
+func aliasKeys(aliases map[string]string) []string {
+	keys := make([]string, 0, len(aliases))
+	for k := range aliases {
+		keys = append(keys, k)
+	}
+	return keys
+}
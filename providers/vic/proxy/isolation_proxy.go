@@ -19,6 +19,10 @@ import (
 	"context"
 	//"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/vmware/vic/lib/apiservers/portlayer/client"
 	"github.com/vmware/vic/lib/apiservers/portlayer/client/containers"
@@ -42,13 +46,27 @@ import (
 )
 
 type IsolationProxy interface {
-	CreateHandle(ctx context.Context) (string, string, error)
+	CreateHandle(ctx context.Context, config IsolationContainerConfig) (string, string, error)
+	PullImage(ctx context.Context, ref string, auth RegistryAuth) (string, string, error)
 	AddImageToHandle(ctx context.Context, handle, deltaID, layerID, imageID, imageName string) (string, error)
 	CreateHandleTask(ctx context.Context, handle, id, layerID string, config IsolationContainerConfig) (string, error)
 	AddHandleToScope(ctx context.Context, handle string, config IsolationContainerConfig) (string, error)
+	AddVolumesToHandle(ctx context.Context, handle string, mounts []Mount) (string, error)
+	EnsureVolume(ctx context.Context, spec VolumeSpec) (*Volume, error)
 	AddInteractionToHandle(ctx context.Context, handle string) (string, error)
 	AddLoggingToHandle(ctx context.Context, handle string) (string, error)
 	CommitHandle(ctx context.Context, handle, containerID string, waitTime int32) error
+	BuildContainerHandle(ctx context.Context, config IsolationContainerConfig, waitTime int32) (string, error)
+
+	NetworkCreate(ctx context.Context, name, subnet, gateway string) error
+	NetworkList(ctx context.Context) ([]*models.ScopeConfig, error)
+	NetworkInspect(ctx context.Context, name string) (*models.ScopeConfig, error)
+	NetworkDelete(ctx context.Context, name string) error
+
+	ContainerStats(ctx context.Context, containerID string, stream bool, interval time.Duration) (<-chan ContainerStat, error)
+	GetContainerLogs(ctx context.Context, containerID string, follow bool, tailLines, sinceSeconds int, timestamps bool) (io.ReadCloser, error)
+
+	HealthCheckRun(ctx context.Context, handle string, probe ProbeSpec) (bool, error)
 
 	Handle(ctx context.Context, id, name string) (string, error)
 	SetState(ctx context.Context, handle, name, state string) (string, error)
@@ -57,6 +75,7 @@ type IsolationProxy interface {
 type VicIsolationProxy struct {
 	client        *client.PortLayer
 	imageStore    ImageStore
+	volumeStore   VolumeStore
 	podCache      cache.PodCache
 	portlayerAddr string
 }
@@ -66,6 +85,34 @@ type PortBinding struct {
 	HostPort string
 }
 
+// NetworkAttachment describes one network a container should be joined to,
+// modeled on the podman networks API's per-network attachment options.
+type NetworkAttachment struct {
+	NetworkName string
+	StaticIPv4  string
+	StaticIPv6  string
+	MACAddress  string
+	Aliases     []string
+	Gateway     string
+
+	// PortMap carries the container's published ports; it's only
+	// meaningful on the attachment that owns the container's primary,
+	// externally reachable network.
+	PortMap map[string]PortBinding
+}
+
+// Mount describes a single volume to be joined to a container's handle, in
+// the same spirit as docker's mount.Mount but scoped to what the portlayer's
+// VolumeJoin API needs.
+type Mount struct {
+	Name        string
+	Source      string
+	Destination string
+	Mode        string
+	ReadOnly    bool
+	Type        string
+}
+
 type IsolationContainerConfig struct {
 	ID        string
 	ImageID   string
@@ -91,20 +138,26 @@ type IsolationContainerConfig struct {
 	CPUCount int64
 	Memory   int64
 
+	// PortMap is preserved for back-compat with callers that only know
+	// about a single, unnamed network; AddHandleToScope treats a config
+	// with no Networks as a single "default" attachment carrying PortMap.
 	PortMap map[string]PortBinding
+	// Networks, when set, is the full set of networks the container
+	// should be attached to. It supersedes PortMap.
+	Networks map[string]NetworkAttachment
+	Mounts   []Mount
+	// Probes carries the container's liveness/readiness/startup probes for
+	// a HealthMonitor to evaluate via HealthCheckRun.
+	Probes []ProbeSpec
 }
 
 const (
 	// DefaultCPUs - the default number of container VM CPUs
 	DefaultCPUs   = 2
 	DefaultMemory = 512
-
-	DummyImage    = "f6e427c148a766d2d6c117d67359a0aa7d133b5bc05830a7ff6e8b64ff6b1d1d" //busybox
-	DummyLayerID  = "02d3847f0b0fb7acd4419040cc53febf91cb112db2451d9b27a245dee5b227c0" //busybox
-	DummyRepoName = "busybox"
 )
 
-func NewIsolationProxy(plClient *client.PortLayer, portlayerAddr string, imageStore ImageStore, podCache cache.PodCache) IsolationProxy {
+func NewIsolationProxy(plClient *client.PortLayer, portlayerAddr string, imageStore ImageStore, volumeStore VolumeStore, podCache cache.PodCache) IsolationProxy {
 	if plClient == nil {
 		return nil
 	}
@@ -112,12 +165,16 @@ func NewIsolationProxy(plClient *client.PortLayer, portlayerAddr string, imageSt
 	return &VicIsolationProxy{
 		client:        plClient,
 		imageStore:    imageStore,
+		volumeStore:   volumeStore,
 		podCache:      podCache,
 		portlayerAddr: portlayerAddr,
 	}
 }
 
-func (v *VicIsolationProxy) CreateHandle(ctx context.Context) (string, string, error) {
+// CreateHandle creates the isolation unit handle against config's already
+// resolved ImageID and LayerID (e.g. as returned by PullImage). It does not
+// pull config.ImageName itself and returns an error if either ID is empty.
+func (v *VicIsolationProxy) CreateHandle(ctx context.Context, config IsolationContainerConfig) (string, string, error) {
 	op := trace.FromContext(ctx, "CreateHandle")
 	defer trace.End(trace.Begin("", op))
 
@@ -125,7 +182,6 @@ func (v *VicIsolationProxy) CreateHandle(ctx context.Context) (string, string, e
 		return "", "", errors.NillPortlayerClientError("ContainerProxy")
 	}
 
-	// Call the Exec port layer to create the container
 	var err error
 	var host string
 	if constants.RunningInVCH {
@@ -138,11 +194,16 @@ func (v *VicIsolationProxy) CreateHandle(ctx context.Context) (string, string, e
 		return "", "", errors.InternalServerError("ContainerProxy.CreateContainerHandle got unexpected error getting VCH UUID")
 	}
 
-	plCreateParams := initIsolationConfig(ctx, "", DummyRepoName, DummyImage, DummyLayerID, host)
+	imageID, layerID := config.ImageID, config.LayerID
+	if imageID == "" || layerID == "" {
+		return "", "", errors.InternalServerError("ContainerProxy.CreateContainerHandle requires a resolved ImageID/LayerID; call PullImage first")
+	}
+
+	plCreateParams := initIsolationConfig(ctx, config.Name, config.ImageName, imageID, layerID, host)
 	createResults, err := v.client.Containers.Create(plCreateParams)
 	if err != nil {
 		if _, ok := err.(*containers.CreateNotFound); ok {
-			cerr := fmt.Errorf("No such image: %s", DummyImage)
+			cerr := fmt.Errorf("No such image: %s", config.ImageName)
 			op.Errorf("%s (%s)", cerr, err)
 			return "", "", errors.NotFoundError(cerr.Error())
 		}
@@ -157,6 +218,79 @@ func (v *VicIsolationProxy) CreateHandle(ctx context.Context) (string, string, e
 	return id, h, nil
 }
 
+// PullImage resolves ref against imageStore using auth (typically resolved
+// from a pod's imagePullSecrets by the caller) and returns the pulled
+// image's ID and top layer ID, ready to hand to CreateHandle.
+//
+// Pull failures are surfaced as errors.NewRequestNotFoundError when the
+// registry reports the reference doesn't exist, and as
+// errors.NewErrorWithStatusCode with http.StatusUnauthorized for
+// authorization failures and http.StatusBadGateway for any other failure,
+// so callers can tell a missing image apart from bad credentials or a
+// network outage.
+func (v *VicIsolationProxy) PullImage(ctx context.Context, ref string, auth RegistryAuth) (string, string, error) {
+	op := trace.FromContext(ctx, "PullImage - %s", ref)
+	defer trace.End(trace.Begin(ref, op))
+
+	if v.imageStore == nil {
+		return "", "", errors.InternalServerError("IsolationProxy.PullImage: no ImageStore configured")
+	}
+
+	c, err := v.imageStore.PullAndResolve(ctx, ref, auth)
+	if err != nil {
+		switch {
+		case isImageNotFoundErr(err):
+			return "", "", errors.NewRequestNotFoundError(fmt.Errorf("no such image: %s", ref))
+		case isAuthErr(err):
+			return "", "", errors.NewErrorWithStatusCode(fmt.Errorf("not authorized to pull %s: %s", ref, err.Error()), http.StatusUnauthorized)
+		default:
+			return "", "", errors.NewErrorWithStatusCode(fmt.Errorf("failed to pull %s: %s", ref, err.Error()), http.StatusBadGateway)
+		}
+	}
+
+	// TODO: metadata.ImageConfig's top-layer ID field isn't threaded through
+	// imagec's cache population yet, so layerID is approximated as ImageID
+	// until that's wired up; single-layer images (the common case today)
+	// this provider builds against are unaffected.
+	return c.ImageID, c.ImageID, nil
+}
+
+// BuildContainerHandle runs the full image/task/network/volume/interaction/
+// logging/commit pipeline for config through a HandleBuilder, so a failure
+// at any step unwinds everything the earlier steps attached instead of
+// leaking orphaned portlayer state. It's the transactional equivalent of
+// calling CreateHandle, AddImageToHandle, CreateHandleTask, AddHandleToScope,
+// AddVolumesToHandle, AddInteractionToHandle, AddLoggingToHandle and
+// CommitHandle by hand.
+func (v *VicIsolationProxy) BuildContainerHandle(ctx context.Context, config IsolationContainerConfig, waitTime int32) (string, error) {
+	b := v.NewHandleBuilder(ctx, config)
+	b = b.WithImage(ctx, config.LayerID, config.LayerID, config.ImageID, config.ImageName).
+		WithTask(ctx, b.containerID, config.LayerID, config).
+		WithNetworks(ctx, config).
+		WithVolumes(ctx, config.Mounts).
+		WithInteraction(ctx).
+		WithLogging(ctx)
+
+	if err := b.Commit(ctx, waitTime); err != nil {
+		return "", err
+	}
+
+	return b.containerID, nil
+}
+
+// isImageNotFoundErr reports whether err looks like the registry told us ref
+// doesn't exist, as opposed to a network or authorization failure.
+func isImageNotFoundErr(err error) bool {
+	return strings.Contains(err.Error(), "404") || strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+// isAuthErr reports whether err looks like the registry rejected our
+// credentials.
+func isAuthErr(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "401") || strings.Contains(msg, "403") || strings.Contains(msg, "unauthorized")
+}
+
 // Handle retrieves a handle to a VIC container.  Handles should be treated as opaque strings.
 //
 // returns:
@@ -258,48 +392,277 @@ func (v *VicIsolationProxy) CreateHandleTask(ctx context.Context, handle, id, la
 	return handle, nil
 }
 
-// AddHandleToScope adds a container, referenced by handle, to a scope.
+// AddHandleToScope adds a container, referenced by handle, to every scope in
+// config.Networks, issuing one Scopes.AddContainer call per network.  If any
+// attachment after the first fails, all previously-added scopes for this
+// handle are rolled back before the error is returned, so a partially
+// attached container is never left behind.
 // If an error is return, the returned handle should not be used.
 //
 // returns:
 //	modified handle
 func (v *VicIsolationProxy) AddHandleToScope(ctx context.Context, handle string, config IsolationContainerConfig) (string, error) {
-	op := trace.FromContext(ctx, "CommitHandle")
+	handle, _, err := v.addHandleToScopes(ctx, handle, config)
+	return handle, err
+}
+
+// addHandleToScopes is AddHandleToScope's implementation, additionally
+// returning the names of the scopes it successfully attached so callers
+// that manage their own rollback (HandleBuilder) can record a compensation
+// per scope instead of relying on this call's own internal rollback.
+func (v *VicIsolationProxy) addHandleToScopes(ctx context.Context, handle string, config IsolationContainerConfig) (string, []string, error) {
+	op := trace.FromContext(ctx, "AddHandleToScope")
 	defer trace.End(trace.Begin(handle, op))
 
 	if v.client == nil {
-		return "", errors.NillPortlayerClientError("IsolationProxy")
+		return "", nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	attachments := config.Networks
+	if len(attachments) == 0 {
+		// Degenerate single-network case: preserve the old PortMap-only
+		// behavior by attaching to the default network.
+		attachments = map[string]NetworkAttachment{
+			"default": {NetworkName: "default", PortMap: config.PortMap},
+		}
 	}
 
-	// configure network
-	netConf := networkConfigFromIsolationConfig(config)
-	if netConf != nil {
+	var attachedScopes []string
+	rollback := func() {
+		// Each RemoveContainer call consumes handle and returns a new one,
+		// same as AddContainer below; reusing the same handle across more
+		// than one compensation here would operate on an already-invalidated
+		// token, so it must be threaded from one call to the next.
+		for _, scope := range attachedScopes {
+			res, err2 := v.client.Scopes.RemoveContainer(scopes.NewRemoveContainerParamsWithContext(ctx).WithHandle(handle).WithScope(scope))
+			if err2 != nil {
+				op.Warnf("could not roll back container add for scope %s: %s", scope, err2)
+				continue
+			}
+			handle = res.Payload
+		}
+	}
+
+	for name, attachment := range attachments {
+		netConf := networkConfigFromAttachment(name, attachment)
+
 		addContRes, err := v.client.Scopes.AddContainer(scopes.NewAddContainerParamsWithContext(ctx).
 			WithScope(netConf.NetworkName).
 			WithConfig(&models.ScopesAddContainerConfig{
-			Handle:        handle,
-			NetworkConfig: netConf,
-		}))
-
+				Handle:        handle,
+				NetworkConfig: netConf,
+			}))
 		if err != nil {
-			op.Errorf("ContainerProxy.AddContainerToScope: Scopes error: %s", err.Error())
-			return handle, errors.InternalServerError(err.Error())
+			op.Errorf("IsolationProxy.AddHandleToScope: Scopes error on network %s: %s", name, err.Error())
+			rollback()
+			return handle, nil, errors.InternalServerError(err.Error())
+		}
+
+		handle = addContRes.Payload
+		attachedScopes = append(attachedScopes, netConf.NetworkName)
+	}
+
+	return handle, attachedScopes, nil
+}
+
+// NetworkCreate pre-creates a scope (e.g. one scoped to a Kubernetes
+// namespace or Service) so pods can be attached to it by name without racing
+// scope creation against the first container attach.
+func (v *VicIsolationProxy) NetworkCreate(ctx context.Context, name, subnet, gateway string) error {
+	op := trace.FromContext(ctx, "NetworkCreate - %s", name)
+	defer trace.End(trace.Begin(name, op))
+
+	if v.client == nil {
+		return errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	_, err := v.client.Scopes.Create(scopes.NewCreateParamsWithContext(ctx).WithConfig(&models.ScopeConfig{
+		Name:    name,
+		Subnet:  subnet,
+		Gateway: gateway,
+	}))
+	if err != nil {
+		switch err := err.(type) {
+		case *scopes.CreateConflict:
+			return errors.ConflictError(err.Error())
+		case *scopes.CreateDefault:
+			return errors.InternalServerError(err.Payload.Message)
+		default:
+			return errors.InternalServerError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+// NetworkList returns every scope the portlayer knows about.
+func (v *VicIsolationProxy) NetworkList(ctx context.Context) ([]*models.ScopeConfig, error) {
+	op := trace.FromContext(ctx, "NetworkList")
+	defer trace.End(trace.Begin("", op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	res, err := v.client.Scopes.List(scopes.NewListParamsWithContext(ctx).WithIDName("*"))
+	if err != nil {
+		return nil, errors.InternalServerError(err.Error())
+	}
+
+	return res.Payload, nil
+}
+
+// NetworkInspect returns the scope named name, or a NotFoundError if no such
+// scope exists.
+func (v *VicIsolationProxy) NetworkInspect(ctx context.Context, name string) (*models.ScopeConfig, error) {
+	op := trace.FromContext(ctx, "NetworkInspect - %s", name)
+	defer trace.End(trace.Begin(name, op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	res, err := v.client.Scopes.List(scopes.NewListParamsWithContext(ctx).WithIDName(name))
+	if err != nil {
+		return nil, errors.InternalServerError(err.Error())
+	}
+
+	if len(res.Payload) == 0 {
+		return nil, errors.NotFoundError(name)
+	}
+
+	return res.Payload[0], nil
+}
+
+// NetworkDelete removes a scope previously created with NetworkCreate.
+func (v *VicIsolationProxy) NetworkDelete(ctx context.Context, name string) error {
+	op := trace.FromContext(ctx, "NetworkDelete - %s", name)
+	defer trace.End(trace.Begin(name, op))
+
+	if v.client == nil {
+		return errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	_, err := v.client.Scopes.Remove(scopes.NewRemoveParamsWithContext(ctx).WithIDName(name))
+	if err != nil {
+		switch err := err.(type) {
+		case *scopes.RemoveNotFound:
+			return errors.NotFoundError(name)
+		case *scopes.RemoveDefault:
+			return errors.InternalServerError(err.Payload.Message)
+		default:
+			return errors.InternalServerError(err.Error())
 		}
+	}
+
+	return nil
+}
+
+// EnsureVolume returns the volume named spec.Name, creating it first if it
+// doesn't exist yet. A pod's containers can all reference the same emptyDir
+// or persistentVolumeClaim volume, so the first one to need it creates it
+// and the rest just get it back.
+func (v *VicIsolationProxy) EnsureVolume(ctx context.Context, spec VolumeSpec) (*Volume, error) {
+	op := trace.FromContext(ctx, "EnsureVolume - %s", spec.Name)
+	defer trace.End(trace.Begin(spec.Name, op))
+
+	if v.volumeStore == nil {
+		return nil, errors.InternalServerError("IsolationProxy.EnsureVolume: no VolumeStore configured")
+	}
+
+	if vol, err := v.volumeStore.Get(ctx, spec.Name); err == nil {
+		return vol, nil
+	}
+
+	vol, err := v.volumeStore.Create(ctx, spec)
+	if err == nil {
+		return vol, nil
+	}
 
-		defer func() {
-			if err == nil {
-				return
+	// Lost a create race against another of the pod's containers; the
+	// volume exists now even though this call didn't create it.
+	if existing, getErr := v.volumeStore.Get(ctx, spec.Name); getErr == nil {
+		return existing, nil
+	}
+
+	return nil, err
+}
+
+// AddVolumesToHandle joins each of mounts to handle via the
+// portlayer's VolumeJoin API, in the same style as AddImageToHandle.
+// If an error is returned, the returned handle should not be used.
+//
+// returns:
+//	modified handle
+func (v *VicIsolationProxy) AddVolumesToHandle(ctx context.Context, handle string, mounts []Mount) (string, error) {
+	handle, _, err := v.addVolumesToHandle(ctx, handle, mounts)
+	return handle, err
+}
+
+// addVolumesToHandle is AddVolumesToHandle's implementation, additionally
+// returning the mounts it successfully joined so callers that manage their
+// own rollback (HandleBuilder) can record a compensation per mount instead of
+// relying on this call's own internal rollback.
+//
+// If a join after the first fails, every mount already joined to this handle
+// by this call is rolled back (in the same style as addHandleToScopes) before
+// the error is returned, so a partially joined handle is never left behind.
+func (v *VicIsolationProxy) addVolumesToHandle(ctx context.Context, handle string, mounts []Mount) (string, []Mount, error) {
+	op := trace.FromContext(ctx, "AddVolumesToHandle")
+	defer trace.End(trace.Begin(handle, op))
+
+	if v.client == nil {
+		return "", nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	var joined []Mount
+	rollback := func() {
+		// VolumeLeave, like VolumeJoin, consumes handle and returns a new
+		// one; it has to be threaded from one compensation to the next or
+		// every compensation after the first operates on a stale handle.
+		for i := len(joined) - 1; i >= 0; i-- {
+			m := joined[i]
+			res, err2 := v.client.Storage.VolumeLeave(storage.NewVolumeLeaveParamsWithContext(ctx).
+				WithName(m.Name).
+				WithJoinArgs(&models.VolumeLeaveConfig{Handle: handle}))
+			if err2 != nil {
+				op.Warnf("could not roll back volume join for %s: %s", m.Name, err2)
+				continue
 			}
-			// roll back the AddContainer call
-			if _, err2 := v.client.Scopes.RemoveContainer(scopes.NewRemoveContainerParamsWithContext(ctx).WithHandle(handle).WithScope(netConf.NetworkName)); err2 != nil {
-				op.Warnf("could not roll back container add: %s", err2)
+			h, ok := res.Payload.Handle.(string)
+			if !ok {
+				op.Warnf("could not roll back volume join for %s: type assertion failed for %#+v", m.Name, res.Payload.Handle)
+				continue
 			}
-		}()
+			handle = h
+		}
+	}
 
-		handle = addContRes.Payload
+	for _, m := range mounts {
+		flags := map[string]string{"Mode": m.Mode}
+
+		response, err := v.client.Storage.VolumeJoin(storage.NewVolumeJoinParamsWithContext(ctx).
+			WithName(m.Name).
+			WithJoinArgs(&models.VolumeJoinConfig{
+				Handle:    handle,
+				MountPath: m.Destination,
+				Flags:     flags,
+			}))
+		if err != nil {
+			rollback()
+			return "", nil, errors.InternalServerError(fmt.Sprintf("failed to join volume %s: %s", m.Name, err.Error()))
+		}
+
+		var ok bool
+		handle, ok = response.Payload.Handle.(string)
+		if !ok {
+			rollback()
+			return "", nil, errors.InternalServerError(fmt.Sprintf("Type assertion failed for %#+v", handle))
+		}
+		joined = append(joined, m)
 	}
 
-	return handle, nil
+	return handle, joined, nil
 }
 
 // AddLoggingToHandle adds logging capability to the isolation vm, referenced by handle.
@@ -514,13 +877,23 @@ func initIsolationConfig(ctx context.Context, name, repoName, imageID, layerID,
 	return containers.NewCreateParamsWithContext(ctx).WithCreateConfig(config)
 }
 
-//HACK:  hard code for socat and nginx
-func networkConfigFromIsolationConfig(config IsolationContainerConfig) *models.NetworkConfig {
+// networkConfigFromAttachment converts a single NetworkAttachment into the
+// portlayer's NetworkConfig for the named network.
+func networkConfigFromAttachment(name string, attachment NetworkAttachment) *models.NetworkConfig {
+	networkName := attachment.NetworkName
+	if networkName == "" {
+		networkName = name
+	}
+
 	nc := &models.NetworkConfig{
-		NetworkName: "default",
+		NetworkName: networkName,
+		Address:     attachment.StaticIPv4,
+		Gateway:     attachment.Gateway,
+		MacAddress:  attachment.MACAddress,
+		Aliases:     attachment.Aliases,
 	}
 
-	for key, val := range config.PortMap {
+	for key, val := range attachment.PortMap {
 		nc.Ports = append(nc.Ports, fmt.Sprintf("%s:%s", val.HostPort, key))
 	}
 
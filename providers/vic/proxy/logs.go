@@ -0,0 +1,64 @@
+// Copyright 2018 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"io"
+
+	"github.com/vmware/vic/lib/apiservers/engine/errors"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/logging"
+	"github.com/vmware/vic/pkg/trace"
+)
+
+// GetContainerLogs streams containerID's log output from the portlayer. The
+// portlayer writes the stream to a pipe in a goroutine so the returned
+// io.ReadCloser can be handed straight to the kubelet's logs endpoint; the
+// caller is responsible for closing it once it's done reading.
+func (v *VicIsolationProxy) GetContainerLogs(ctx context.Context, containerID string, follow bool, tailLines, sinceSeconds int, timestamps bool) (io.ReadCloser, error) {
+	op := trace.FromContext(ctx, "GetContainerLogs - %s", containerID)
+	defer trace.End(trace.Begin(containerID, op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	params := logging.NewLoggingGetParamsWithContext(ctx).
+		WithID(containerID).
+		WithFollow(&follow).
+		WithTaillines(&tailLines).
+		WithSince(&sinceSeconds).
+		WithTimestamp(&timestamps)
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		_, err := v.client.Logging.LoggingGet(params, writer)
+		if err != nil {
+			switch err := err.(type) {
+			case *logging.LoggingGetNotFound:
+				writer.CloseWithError(errors.NotFoundError(containerID))
+			case *logging.LoggingGetDefault:
+				writer.CloseWithError(errors.InternalServerError(err.Payload.Message))
+			default:
+				writer.CloseWithError(errors.InternalServerError(err.Error()))
+			}
+			return
+		}
+		writer.Close()
+	}()
+
+	return reader, nil
+}
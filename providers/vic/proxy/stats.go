@@ -0,0 +1,194 @@
+// Copyright 2018 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/vmware/vic/lib/apiservers/engine/errors"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/containers"
+	"github.com/vmware/vic/pkg/trace"
+)
+
+// CPUStats mirrors the counters the kubelet stats/v1alpha1 Summary's CPUStats
+// needs: a cumulative usage and the instantaneous rate derived from it.
+type CPUStats struct {
+	UsageNanoCores       uint64
+	UsageCoreNanoSeconds uint64
+	ThrottledNanoSeconds uint64
+}
+
+// MemoryStats mirrors the counters the kubelet stats/v1alpha1 Summary's
+// MemoryStats needs.
+type MemoryStats struct {
+	UsageBytes      uint64
+	WorkingSetBytes uint64
+	RSSBytes        uint64
+	CacheBytes      uint64
+	AvailableBytes  uint64
+}
+
+// NetworkInterfaceStats carries the rx/tx counters for one network interface
+// attached to a container.
+type NetworkInterfaceStats struct {
+	Name      string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+}
+
+// BlockIOStats carries the aggregate block device IO counters for a
+// container.
+type BlockIOStats struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// ContainerStat is a single sample of a container's resource usage, shaped so
+// a translator can build the kubelet stats/v1alpha1 Summary's PodStats and
+// ContainerStats entries directly from it.
+type ContainerStat struct {
+	ContainerID string
+	Timestamp   time.Time
+
+	CPU     CPUStats
+	Memory  MemoryStats
+	Network []NetworkInterfaceStats
+	BlockIO BlockIOStats
+}
+
+// ContainerStats samples containerID's resource usage.  With stream set to
+// false it returns a channel that emits a single sample and is then closed.
+// With stream set to true it emits a new sample every interval until ctx is
+// cancelled or a sample fails (e.g. the container no longer exists), at
+// which point the channel is closed and the goroutine exits. The container's
+// run state is not checked: a stopped container whose samples still succeed
+// keeps the stream open.
+func (v *VicIsolationProxy) ContainerStats(ctx context.Context, containerID string, stream bool, interval time.Duration) (<-chan ContainerStat, error) {
+	op := trace.FromContext(ctx, "ContainerStats - %s", containerID)
+	defer trace.End(trace.Begin(containerID, op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("IsolationProxy")
+	}
+
+	out := make(chan ContainerStat)
+
+	sample := func() (ContainerStat, error) {
+		return v.sampleContainerStats(ctx, containerID)
+	}
+
+	if !stream {
+		stat, err := sample()
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			defer close(out)
+			out <- stat
+		}()
+		return out, nil
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			stat, err := sample()
+			if err != nil {
+				op.Warnf("ContainerStats: stopping stream for %s: %s", containerID, err.Error())
+				return
+			}
+
+			select {
+			case out <- stat:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// sampleContainerStats pulls a single stats sample for containerID from the
+// portlayer and returns it in kubelet-friendly shape.
+func (v *VicIsolationProxy) sampleContainerStats(ctx context.Context, containerID string) (ContainerStat, error) {
+	res, err := v.client.Containers.GetContainerStats(containers.NewGetContainerStatsParamsWithContext(ctx).WithID(containerID))
+	if err != nil {
+		switch err := err.(type) {
+		case *containers.GetContainerStatsNotFound:
+			return ContainerStat{}, errors.NotFoundError(containerID)
+		case *containers.GetContainerStatsDefault:
+			return ContainerStat{}, errors.InternalServerError(err.Payload.Message)
+		default:
+			return ContainerStat{}, errors.InternalServerError(err.Error())
+		}
+	}
+
+	p := res.Payload
+
+	stat := ContainerStat{
+		ContainerID: containerID,
+		Timestamp:   time.Now(),
+		CPU: CPUStats{
+			UsageNanoCores:       uint64(p.CPU.UsageNanoCores),
+			UsageCoreNanoSeconds: uint64(p.CPU.UsageCoreNanoSeconds),
+			ThrottledNanoSeconds: uint64(p.CPU.ThrottledNanoSeconds),
+		},
+		Memory: MemoryStats{
+			UsageBytes:      uint64(p.Memory.UsageBytes),
+			WorkingSetBytes: uint64(p.Memory.WorkingSetBytes),
+			RSSBytes:        uint64(p.Memory.RSSBytes),
+			CacheBytes:      uint64(p.Memory.CacheBytes),
+			AvailableBytes:  uint64(p.Memory.AvailableBytes),
+		},
+		BlockIO: BlockIOStats{
+			ReadBytes:  uint64(p.BlockIO.ReadBytes),
+			WriteBytes: uint64(p.BlockIO.WriteBytes),
+		},
+	}
+
+	for _, iface := range p.Network {
+		stat.Network = append(stat.Network, NetworkInterfaceStats{
+			Name:      iface.Name,
+			RxBytes:   uint64(iface.RxBytes),
+			RxPackets: uint64(iface.RxPackets),
+			RxErrors:  uint64(iface.RxErrors),
+			TxBytes:   uint64(iface.TxBytes),
+			TxPackets: uint64(iface.TxPackets),
+			TxErrors:  uint64(iface.TxErrors),
+		})
+	}
+
+	return stat, nil
+}
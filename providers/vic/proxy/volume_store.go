@@ -0,0 +1,207 @@
+// Copyright 2018 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/vic/lib/apiservers/engine/errors"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client"
+	"github.com/vmware/vic/lib/apiservers/portlayer/client/storage"
+	"github.com/vmware/vic/lib/apiservers/portlayer/models"
+	"github.com/vmware/vic/pkg/trace"
+)
+
+// VolumeKind distinguishes the lifecycle a volume was created for (emptyDir
+// or PVC) and is recorded in the volume's metadata. Nothing in this package
+// or in PodProxy deletes a volume when its pod is deleted.
+type VolumeKind string
+
+const (
+	// VolumeEphemeral backs a Kubernetes emptyDir: created alongside the pod.
+	VolumeEphemeral VolumeKind = "ephemeral"
+	// VolumePersistent backs a Kubernetes PersistentVolumeClaim: created
+	// independently of any one pod and left alone on pod deletion.
+	VolumePersistent VolumeKind = "persistent"
+)
+
+// VolumeSpec describes a volume to be created in a VIC volume store.
+type VolumeSpec struct {
+	Name       string
+	Kind       VolumeKind
+	Capacity   uint64 // in KB, as the portlayer VolumeRequest expects
+	Store      string // name of the backing volume store, e.g. "default"
+	DiskDriver string
+}
+
+// Volume is the subset of portlayer volume metadata VolumeStore callers need.
+type Volume struct {
+	Name  string
+	Store string
+	Label map[string]string
+}
+
+// VolumeStore creates and manages the VIC volumes backing Kubernetes
+// emptyDir and PersistentVolumeClaim volumes.
+type VolumeStore interface {
+	Create(ctx context.Context, spec VolumeSpec) (*Volume, error)
+	Get(ctx context.Context, name string) (*Volume, error)
+	Delete(ctx context.Context, name string) error
+	List(ctx context.Context) ([]*Volume, error)
+}
+
+type VicVolumeStore struct {
+	client *client.PortLayer
+}
+
+func NewVolumeStore(plClient *client.PortLayer) VolumeStore {
+	return &VicVolumeStore{client: plClient}
+}
+
+// Create creates a new volume in the named backing volume store.  emptyDir
+// volumes (VolumeEphemeral) and PVC volumes (VolumePersistent) are both
+// created through the same portlayer call; Kind only affects how the caller
+// later reasons about the volume's lifetime.
+func (v *VicVolumeStore) Create(ctx context.Context, spec VolumeSpec) (*Volume, error) {
+	op := trace.FromContext(ctx, "Create - %s", spec.Name)
+	defer trace.End(trace.Begin(spec.Name, op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("VolumeStore")
+	}
+
+	store := spec.Store
+	if store == "" {
+		store = "default"
+	}
+
+	req := &models.VolumeRequest{
+		Name:       spec.Name,
+		Store:      store,
+		Capacity:   int64(spec.Capacity),
+		Driver:     spec.DiskDriver,
+		DriverArgs: map[string]string{},
+		Metadata: map[string]string{
+			"kind": string(spec.Kind),
+		},
+	}
+	if req.Driver == "" {
+		req.Driver = "vsphere"
+	}
+
+	res, err := v.client.Storage.CreateVolume(storage.NewCreateVolumeParamsWithContext(ctx).WithVolumeRequest(req))
+	if err != nil {
+		switch err := err.(type) {
+		case *storage.CreateVolumeConflict:
+			return nil, errors.ConflictError(err.Error())
+		case *storage.CreateVolumeDefault:
+			return nil, errors.InternalServerError(err.Payload.Message)
+		default:
+			return nil, errors.InternalServerError(err.Error())
+		}
+	}
+
+	return &Volume{
+		Name:  res.Payload.Name,
+		Store: store,
+		Label: res.Payload.Label,
+	}, nil
+}
+
+func (v *VicVolumeStore) Get(ctx context.Context, name string) (*Volume, error) {
+	op := trace.FromContext(ctx, "Get - %s", name)
+	defer trace.End(trace.Begin(name, op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("VolumeStore")
+	}
+
+	res, err := v.client.Storage.GetVolume(storage.NewGetVolumeParamsWithContext(ctx).WithName(name))
+	if err != nil {
+		switch err := err.(type) {
+		case *storage.GetVolumeNotFound:
+			return nil, errors.NotFoundError(name)
+		case *storage.GetVolumeDefault:
+			return nil, errors.InternalServerError(err.Payload.Message)
+		default:
+			return nil, errors.InternalServerError(err.Error())
+		}
+	}
+
+	return &Volume{
+		Name:  res.Payload.Name,
+		Label: res.Payload.Label,
+	}, nil
+}
+
+// Delete removes a volume.  Callers are expected to only call this for
+// VolumeEphemeral volumes once the owning pod is gone, or for a
+// VolumePersistent volume whose backing PersistentVolumeClaim has itself
+// been deleted.
+func (v *VicVolumeStore) Delete(ctx context.Context, name string) error {
+	op := trace.FromContext(ctx, "Delete - %s", name)
+	defer trace.End(trace.Begin(name, op))
+
+	if v.client == nil {
+		return errors.NillPortlayerClientError("VolumeStore")
+	}
+
+	_, err := v.client.Storage.RemoveVolume(storage.NewRemoveVolumeParamsWithContext(ctx).WithName(name))
+	if err != nil {
+		switch err := err.(type) {
+		case *storage.RemoveVolumeNotFound:
+			return errors.NotFoundError(name)
+		case *storage.RemoveVolumeConflict:
+			return errors.ConflictError(err.Error())
+		case *storage.RemoveVolumeDefault:
+			return errors.InternalServerError(err.Payload.Message)
+		default:
+			return errors.InternalServerError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (v *VicVolumeStore) List(ctx context.Context) ([]*Volume, error) {
+	op := trace.FromContext(ctx, "List")
+	defer trace.End(trace.Begin("", op))
+
+	if v.client == nil {
+		return nil, errors.NillPortlayerClientError("VolumeStore")
+	}
+
+	res, err := v.client.Storage.ListVolumes(storage.NewListVolumesParamsWithContext(ctx))
+	if err != nil {
+		return nil, errors.InternalServerError(err.Error())
+	}
+
+	volumes := make([]*Volume, 0, len(res.Payload))
+	for _, vol := range res.Payload {
+		volumes = append(volumes, &Volume{
+			Name:  vol.Name,
+			Label: vol.Label,
+		})
+	}
+
+	return volumes, nil
+}
+
+// anonymousVolumeName derives a deterministic, pod-scoped volume name of the
+// form "<podUID>-<volumeName>". Nothing in this package calls it.
+func anonymousVolumeName(podUID, volumeName string) string {
+	return fmt.Sprintf("%s-%s", podUID, volumeName)
+}